@@ -0,0 +1,18 @@
+package main
+
+import (
+	"github.com/haowei703/webrtc-server/internal/mediafile"
+	"github.com/haowei703/webrtc-server/internal/synthetic"
+	"github.com/pion/webrtc/v3"
+)
+
+// loadClip 读取 IVF（VP8/VP9）或 H.264 Annex-B 文件，path 为空时使用合成的 VP8 关键帧
+func loadClip(path string, width, height int) (*mediafile.Clip, error) {
+	if path == "" {
+		return &mediafile.Clip{
+			MimeType: webrtc.MimeTypeVP8,
+			Frames:   []mediafile.Frame{{Data: synthetic.VP8KeyFrame(width, height)}},
+		}, nil
+	}
+	return mediafile.Load(path)
+}
@@ -0,0 +1,212 @@
+// loadgen 并发建立多个信令会话并推送测试视频，统计连接成功率、首个结果耗时与服务端结果延迟
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/haowei703/webrtc-server/internal/mediafile"
+	"github.com/haowei703/webrtc-server/internal/signalclient"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type options struct {
+	url            string
+	sessions       int
+	ramp           time.Duration
+	duration       time.Duration
+	connectTimeout time.Duration
+	fps            float64
+	bitrate        int // kbps，0 表示不限制
+	stun           string
+	insecure       bool
+	dataChannel    string
+}
+
+func main() {
+	var opts options
+	var clipPath, sinks string
+	var width, height int
+	flag.StringVar(&opts.url, "url", "ws://localhost:8081/ws/signaling", "signaling WebSocket URL")
+	flag.IntVar(&opts.sessions, "sessions", 10, "number of concurrent sessions, the server limits sessions per IP by limits.per_ip")
+	flag.DurationVar(&opts.ramp, "ramp", 100*time.Millisecond, "delay between starting sessions")
+	flag.DurationVar(&opts.duration, "duration", 30*time.Second, "how long each session streams video")
+	flag.DurationVar(&opts.connectTimeout, "connect-timeout", 10*time.Second, "timeout for signaling and ICE")
+	flag.Float64Var(&opts.fps, "fps", 0, "frames per second (default: clip frame rate or 30)")
+	flag.IntVar(&opts.bitrate, "bitrate", 0, "cap sending bitrate in kbps by delaying frames (0 = no cap)")
+	flag.StringVar(&opts.stun, "stun", "", "STUN/TURN server URL used by the clients")
+	flag.BoolVar(&opts.insecure, "insecure", false, "skip TLS certificate verification for wss://")
+	flag.StringVar(&clipPath, "clip", "", "pre-encoded clip (.ivf VP8/VP9 or .h264 Annex-B); empty uses a synthetic VP8 frame")
+	flag.IntVar(&width, "width", 640, "width of the synthetic frame")
+	flag.IntVar(&height, "height", 480, "height of the synthetic frame")
+	flag.StringVar(&sinks, "sinks", "", "sinks query parameter passed to the server")
+	flag.StringVar(&opts.dataChannel, "datachannel", "", "label of the data channel to receive results on (empty = WebSocket only)")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	c, err := loadClip(clipPath, width, height)
+	if err != nil {
+		logger.Error("failed to load clip", "error", err)
+		os.Exit(1)
+	}
+	if opts.fps <= 0 {
+		opts.fps = c.FPS
+		if opts.fps <= 0 {
+			opts.fps = 30
+		}
+	}
+	if sinks != "" {
+		u, err := url.Parse(opts.url)
+		if err != nil {
+			logger.Error("invalid url", "error", err)
+			os.Exit(1)
+		}
+		q := u.Query()
+		q.Set("sinks", sinks)
+		u.RawQuery = q.Encode()
+		opts.url = u.String()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info("starting load", "url", opts.url, "sessions", opts.sessions, "codec", c.MimeType, "frames", len(c.Frames), "fps", opts.fps)
+	start := time.Now()
+	var st stats
+	var wg sync.WaitGroup
+	for i := 0; i < opts.sessions && ctx.Err() == nil; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			r := runSession(ctx, opts, c)
+			if r.err != nil {
+				logger.Warn("session failed", "session", id, "error", r.err)
+			}
+			st.add(r)
+		}(i)
+		select {
+		case <-ctx.Done():
+		case <-time.After(opts.ramp):
+		}
+	}
+	wg.Wait()
+	st.report(os.Stdout, time.Since(start))
+}
+
+// runSession 建立一个会话并推送视频，直到 duration 结束或 ctx 取消
+func runSession(ctx context.Context, opts options, c *mediafile.Clip) sessionResult {
+	var res sessionResult
+	start := time.Now()
+
+	clientOpts := signalclient.Options{DataChannel: opts.dataChannel}
+	if opts.stun != "" {
+		clientOpts.ICEServers = []webrtc.ICEServer{{URLs: []string{opts.stun}}}
+	}
+	if opts.insecure {
+		dialer := *websocket.DefaultDialer
+		dialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		clientOpts.Dialer = &dialer
+	}
+
+	connectCtx, cancel := context.WithTimeout(ctx, opts.connectTimeout)
+	defer cancel()
+	client, err := signalclient.Dial(connectCtx, opts.url, clientOpts)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	defer client.Close()
+
+	track, err := client.AddVideoTrack(c.MimeType)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	if err := client.Negotiate(connectCtx); err != nil {
+		res.err = fmt.Errorf("negotiate: %w", err)
+		return res
+	}
+	if err := client.WaitConnected(connectCtx); err != nil {
+		res.err = fmt.Errorf("connect: %w", err)
+		return res
+	}
+	res.connected = true
+	res.connectTime = time.Since(start)
+
+	streamStart := time.Now()
+	received := make(chan sessionResult, 1)
+	go func() {
+		var r sessionResult
+		for msg := range client.Messages() {
+			if msg.Type != "text" {
+				continue
+			}
+			var text struct {
+				LatencyMS int64 `json:"latency_ms"`
+			}
+			if err := json.Unmarshal(msg.Data, &text); err != nil {
+				continue
+			}
+			r.resultsReceived++
+			if r.firstResult == 0 {
+				r.firstResult = time.Since(streamStart)
+			}
+			if text.LatencyMS > 0 {
+				r.serverLatency = append(r.serverLatency, time.Duration(text.LatencyMS)*time.Millisecond)
+			}
+		}
+		received <- r
+	}()
+
+	streamCtx, cancelStream := context.WithTimeout(ctx, opts.duration)
+	defer cancelStream()
+	res.framesSent, err = stream(streamCtx, track, c, opts)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+		res.err = fmt.Errorf("stream: %w", err)
+	}
+
+	_ = client.Close()
+	r := <-received
+	res.firstResult = r.firstResult
+	res.serverLatency = r.serverLatency
+	res.resultsReceived = r.resultsReceived
+	return res
+}
+
+// stream 按帧率循环发送 clip，设置了码率上限时拉长大帧之后的间隔
+func stream(ctx context.Context, track *webrtc.TrackLocalStaticSample, c *mediafile.Clip, opts options) (int, error) {
+	interval := time.Duration(float64(time.Second) / opts.fps)
+	next := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for sent := 0; ; sent++ {
+		select {
+		case <-ctx.Done():
+			return sent, ctx.Err()
+		case <-timer.C:
+		}
+		frame := c.Frames[sent%len(c.Frames)].Data
+		d := interval
+		if opts.bitrate > 0 {
+			d = max(d, time.Duration(len(frame)*8)*time.Second/time.Duration(opts.bitrate*1000))
+		}
+		if err := track.WriteSample(media.Sample{Data: frame, Duration: d}); err != nil {
+			return sent, err
+		}
+		next = next.Add(d)
+		timer.Reset(time.Until(next))
+	}
+}
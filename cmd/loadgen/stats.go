@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// sessionResult 单个会话的统计
+type sessionResult struct {
+	connected       bool
+	err             error
+	connectTime     time.Duration   // 从拨号到 PeerConnection 建立
+	firstResult     time.Duration   // 从开始发送视频到收到第一条结果，未收到时为 0
+	serverLatency   []time.Duration // 服务端上报的每条结果耗时
+	framesSent      int
+	resultsReceived int
+}
+
+type stats struct {
+	mu      sync.Mutex
+	results []sessionResult
+}
+
+func (s *stats) add(r sessionResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, r)
+}
+
+// report 输出汇总结果
+func (s *stats) report(w io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var connected, withResult, frames, results int
+	var connectTimes, firstResults, latencies []time.Duration
+	errCounts := make(map[string]int)
+	for _, r := range s.results {
+		frames += r.framesSent
+		results += r.resultsReceived
+		if r.err != nil {
+			errCounts[r.err.Error()]++
+		}
+		if !r.connected {
+			continue
+		}
+		connected++
+		connectTimes = append(connectTimes, r.connectTime)
+		if r.firstResult > 0 {
+			withResult++
+			firstResults = append(firstResults, r.firstResult)
+		}
+		latencies = append(latencies, r.serverLatency...)
+	}
+
+	total := len(s.results)
+	fmt.Fprintf(w, "%-22s%d\n", "sessions:", total)
+	fmt.Fprintf(w, "%-22s%d (%.1f%%)\n", "connected:", connected, ratio(connected, total))
+	fmt.Fprintf(w, "%-22s%d (%.1f%%)\n", "with result:", withResult, ratio(withResult, total))
+	fmt.Fprintf(w, "%-22s%d (%.1f/s)\n", "frames sent:", frames, float64(frames)/elapsed.Seconds())
+	fmt.Fprintf(w, "%-22s%d\n", "results received:", results)
+	fmt.Fprintf(w, "%-22s%s\n", "connect time:", formatPercentiles(connectTimes))
+	fmt.Fprintf(w, "%-22s%s\n", "time to first result:", formatPercentiles(firstResults))
+	fmt.Fprintf(w, "%-22s%s\n", "server latency:", formatPercentiles(latencies))
+	for msg, n := range errCounts {
+		fmt.Fprintf(w, "error (%d): %s\n", n, msg)
+	}
+}
+
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+// percentile 使用最近秩法计算分位数，values 需已排序
+func percentile(values []time.Duration, p float64) time.Duration {
+	if len(values) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(values))+0.5) - 1
+	rank = max(0, min(rank, len(values)-1))
+	return values[rank]
+}
+
+func formatPercentiles(values []time.Duration) string {
+	if len(values) == 0 {
+		return "n/a"
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	return fmt.Sprintf("p50=%s p90=%s p99=%s max=%s",
+		percentile(sorted, 50).Round(time.Millisecond),
+		percentile(sorted, 90).Round(time.Millisecond),
+		percentile(sorted, 99).Round(time.Millisecond),
+		sorted[len(sorted)-1].Round(time.Millisecond))
+}
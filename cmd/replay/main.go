@@ -0,0 +1,293 @@
+// replay 将抓包或录制文件中的 RTP 包离线送入与服务端相同的解包、解码与推理流程，
+// 逐帧输出 JSON 结果，输出只依赖输入文件，可用于问题复现与 CI 中的 golden 测试
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/grpc"
+	"github.com/haowei703/webrtc-server/internal/logging"
+	"github.com/haowei703/webrtc-server/internal/recognition"
+	"github.com/haowei703/webrtc-server/internal/rtpsource"
+	"github.com/haowei703/webrtc-server/internal/webrtc"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// replaySessionID 回放时使用的固定会话 ID
+const replaySessionID = "replay"
+
+type options struct {
+	input       string
+	codec       string
+	payloadType uint
+	ssrc        uint
+	pixelFormat string
+	framesDir   string
+	checksum    bool
+	// filters 与 mode 对应服务端的 ?filters= 与 recognition.mode，为空时使用默认配置
+	filters string
+	mode    string
+}
+
+func main() {
+	var opts options
+	var output, logLevel string
+	flag.StringVar(&opts.input, "input", "", "input file: .pcap, .rtpdump, or a server recording (.ivf, .h264)")
+	flag.StringVar(&opts.codec, "codec", "", "video codec of pcap/rtpdump input: VP8, VP9, H264 or H265")
+	flag.UintVar(&opts.payloadType, "pt", 0, "only replay packets with this RTP payload type (0 = any)")
+	flag.UintVar(&opts.ssrc, "ssrc", 0, "only replay this SSRC (0 = first matching stream)")
+	flag.StringVar(&opts.pixelFormat, "pixel-format", "rgba", "decoder output pixel format: rgba or rgb24")
+	flag.StringVar(&opts.framesDir, "frames-dir", "", "write decoded frames as PNG into this directory")
+	var grpcAddress string
+	var grpcTimeout time.Duration
+	flag.StringVar(&grpcAddress, "grpc-address", "", "inference server address; empty skips inference")
+	flag.DurationVar(&grpcTimeout, "grpc-timeout", 3*time.Second, "timeout of each inference request")
+	flag.BoolVar(&opts.checksum, "checksum", true, "include the SHA-256 of each decoded frame")
+	flag.StringVar(&opts.filters, "filters", "", "result filters in the ?filters= syntax, e.g. confidence:0.6,dedup:2s")
+	flag.StringVar(&opts.mode, "mode", "", "recognition mode: debounce or sentence (default debounce)")
+	flag.StringVar(&output, "output", "-", "output file for JSON lines (- = stdout)")
+	flag.StringVar(&logLevel, "log-level", "warn", "log level")
+	flag.Parse()
+
+	logger, err := logging.New(os.Stderr, logging.Options{Level: logLevel, Format: "text"})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if opts.input == "" {
+		fmt.Fprintln(os.Stderr, "-input is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	out := io.Writer(os.Stdout)
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			logger.Error("failed to create output", "error", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	var inference *grpc.Client
+	if grpcAddress != "" {
+		cfg := config.Default().Inference
+		cfg.Address = grpcAddress
+		cfg.Timeout = grpcTimeout
+		// 回放只有一个会话，失败时不切换实例，保证结果可复现
+		cfg.MaxAttempts = 1
+		inference, err = grpc.NewClient(cfg, logger)
+		if err != nil {
+			logger.Error("failed to create inference client", "error", err)
+			os.Exit(1)
+		}
+		defer inference.Close()
+	}
+
+	if err := run(context.Background(), opts, out, logger, inference); err != nil {
+		logger.Error("replay failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run 回放 opts.input，inference 为空时跳过推理
+func run(ctx context.Context, opts options, out io.Writer, logger *slog.Logger, inference *grpc.Client) error {
+	webrtc.RouteFFmpegLogs(logger)
+
+	src, mimeType, err := rtpsource.Open(opts.input)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	codec := opts.codec
+	if mimeType != "" {
+		codec = strings.TrimPrefix(mimeType, "video/")
+	}
+	if codec == "" {
+		return errors.New("-codec is required for pcap and rtpdump input")
+	}
+
+	recognitionCfg := config.Default().Recognition
+	if opts.mode != "" {
+		recognitionCfg.Mode = opts.mode
+	}
+	if !slices.Contains(config.SupportedRecognitionModes, recognitionCfg.Mode) {
+		return fmt.Errorf("-mode %q not supported, expected one of %v", recognitionCfg.Mode, config.SupportedRecognitionModes)
+	}
+	filters, err := recognition.ParseFilters(opts.filters)
+	if err != nil {
+		return err
+	}
+	if len(filters) > 0 && recognitionCfg.Mode == "sentence" {
+		return errors.New("-filters is not supported in sentence mode")
+	}
+
+	sink := newResultSink(json.NewEncoder(out), inference, recognitionCfg, filters)
+	sink.framesDir, sink.checksum = opts.framesDir, opts.checksum
+	if opts.framesDir != "" {
+		if err := os.MkdirAll(opts.framesDir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	var filtered rtpsource.Source = src
+	if mimeType == "" {
+		filtered = &rtpsource.Filter{Source: src, SSRC: uint32(opts.ssrc), PayloadType: uint8(opts.payloadType)}
+	}
+
+	// 帧的到达时间从固定起点开始计算，使输出与运行时间无关
+	start := time.Unix(0, 0).UTC()
+	sink.start = start
+	var pipeline *webrtc.TrackPipeline
+	for {
+		packet, offset, err := filtered.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if pipeline == nil {
+			pipeline, err = webrtc.NewTrackPipeline(strings.ToUpper(codec), packet.SSRC, config.DecoderConfig{PixelFormat: opts.pixelFormat}, sink, webrtc.SinkContext{
+				SessionID: replaySessionID,
+				TrackID:   fmt.Sprintf("%d", packet.SSRC),
+				Logger:    logger,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := pipeline.WriteRTP(ctx, packet, start.Add(offset)); err != nil {
+			return err
+		}
+	}
+	if pipeline == nil {
+		return errors.New("no RTP packets found")
+	}
+	if err := sink.Close(); err != nil {
+		return err
+	}
+	logger.Info("replay finished", "frames", pipeline.Sequence())
+	return nil
+}
+
+// frameRecord 输出的一行
+type frameRecord struct {
+	Sequence     uint64       `json:"sequence"`
+	RTPTimestamp uint32       `json:"rtp_timestamp"`
+	OffsetMS     int64        `json:"offset_ms"`
+	Width        int          `json:"width"`
+	Height       int          `json:"height"`
+	SHA256       string       `json:"sha256,omitempty"`
+	Result       *grpc.Result `json:"result,omitempty"`
+	// Messages 该帧经过滤或聚合后下发给客户端的 text 消息
+	Messages []webrtc.TextMessage `json:"messages,omitempty"`
+	Error    string               `json:"error,omitempty"`
+}
+
+// resultSink 逐帧输出解码结果，以及经过与服务端相同的 InferenceSink 得到的识别结果
+type resultSink struct {
+	enc       *json.Encoder
+	inference *webrtc.InferenceSink
+	framesDir string
+	checksum  bool
+	start     time.Time
+
+	// result 与 messages 收集 inference 对当前帧的输出
+	result   *grpc.Result
+	messages []webrtc.TextMessage
+}
+
+// newResultSink client 为空时跳过推理
+func newResultSink(enc *json.Encoder, client *grpc.Client, cfg config.RecognitionConfig, filters []config.FilterConfig) *resultSink {
+	s := &resultSink{enc: enc}
+	if client != nil {
+		results := &webrtc.FrameResults{}
+		results.Subscribe(func(_ uint64, result grpc.Result) { s.result = &result })
+		s.inference = webrtc.NewInferenceSink(client, cfg, filters, s.collect, results)
+	}
+	return s
+}
+
+// collect 保存下发的消息，去掉与运行时间有关的耗时以及与帧记录重复的字段
+func (s *resultSink) collect(msg webrtc.TextMessage) error {
+	msg.LatencyMS, msg.Frame, msg.Result = 0, nil, nil
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func (s *resultSink) HandleFrame(ctx context.Context, frame *webrtc.Frame) error {
+	record := frameRecord{
+		Sequence:     frame.Sequence,
+		RTPTimestamp: frame.RTPTimestamp,
+		OffsetMS:     frame.ReceivedAt.Sub(s.start).Milliseconds(),
+		Width:        frame.Width,
+		Height:       frame.Height,
+	}
+	if s.checksum {
+		sum := sha256.Sum256(frame.Data)
+		record.SHA256 = hex.EncodeToString(sum[:])
+	}
+	if s.framesDir != "" {
+		if err := writePNG(filepath.Join(s.framesDir, fmt.Sprintf("%06d.png", frame.Sequence)), frame); err != nil {
+			return err
+		}
+	}
+	if s.inference != nil {
+		s.result, s.messages = nil, nil
+		if err := s.inference.HandleFrame(ctx, frame); err != nil {
+			record.Error = err.Error()
+		}
+		record.Result, record.Messages = s.result, s.messages
+	}
+	return s.enc.Encode(record)
+}
+
+// Close 输出 sentence 模式下回放结束时补发的句子，这一行没有对应的帧
+func (s *resultSink) Close() error {
+	if s.inference == nil {
+		return nil
+	}
+	s.messages = nil
+	if err := s.inference.Close(); err != nil {
+		return err
+	}
+	if len(s.messages) == 0 {
+		return nil
+	}
+	return s.enc.Encode(struct {
+		Messages []webrtc.TextMessage `json:"messages"`
+	}{s.messages})
+}
+
+func writePNG(path string, frame *webrtc.Frame) error {
+	img, err := frame.Image()
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/grpc"
+	"github.com/haowei703/webrtc-server/internal/grpc/grpctest"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// replay 使用脚本化的模拟推理服务回放 input
+func replay(t *testing.T, opts options) []byte {
+	t.Helper()
+	mock := grpctest.NewServer()
+	t.Cleanup(mock.Close)
+	mock.Script(grpctest.Response{Result: "你好"}, grpctest.Response{Result: "result is None"}, grpctest.Response{Result: "谢谢"})
+
+	cfg := config.Default().Inference
+	cfg.Endpoints = []string{mock.Target()}
+	client, err := grpc.NewClient(cfg, testLogger, mock.DialOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	var out bytes.Buffer
+	if err := run(context.Background(), opts, &out, testLogger, client); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestReplayGolden(t *testing.T) {
+	golden := filepath.Join("testdata", "synthetic_vp8.golden")
+	for _, tc := range []struct {
+		name  string
+		input string
+		codec string
+	}{
+		{"ivf", "synthetic_vp8.ivf", ""},
+		{"rtpdump", "synthetic_vp8.rtpdump", "VP8"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// 解码结果的校验和依赖 FFmpeg 版本，golden 文件只比较帧信息与推理结果
+			got := replay(t, options{input: filepath.Join("testdata", tc.input), codec: tc.codec, pixelFormat: "rgba"})
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("output differs from %s (run with -update to accept):\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+func TestReplayDeterministic(t *testing.T) {
+	opts := options{input: filepath.Join("testdata", "synthetic_vp8.ivf"), pixelFormat: "rgba", checksum: true}
+	first := replay(t, opts)
+	if !bytes.Contains(first, []byte(`"sha256":"`)) {
+		t.Fatalf("output has no checksums:\n%s", first)
+	}
+	if second := replay(t, opts); !bytes.Equal(first, second) {
+		t.Errorf("replay is not deterministic:\n%s\n%s", first, second)
+	}
+}
+
+func TestReplayFilters(t *testing.T) {
+	// 脚本中没有连续相同的结果，consecutive:2 过滤后不应下发任何消息，但仍输出每帧的识别结果
+	got := replay(t, options{input: filepath.Join("testdata", "synthetic_vp8.ivf"), pixelFormat: "rgba", filters: "consecutive:2"})
+	if bytes.Contains(got, []byte(`"messages"`)) || bytes.Count(got, []byte(`"result":{"label"`)) != 3 {
+		t.Fatalf("unexpected output with filters:\n%s", got)
+	}
+	var out bytes.Buffer
+	err := run(context.Background(), options{input: filepath.Join("testdata", "synthetic_vp8.ivf"), filters: "dedup:1s", mode: "sentence"}, &out, testLogger, nil)
+	if err == nil {
+		t.Fatal("filters accepted in sentence mode")
+	}
+}
@@ -1,20 +1,126 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/grpc"
+	"github.com/haowei703/webrtc-server/internal/logging"
 	"github.com/haowei703/webrtc-server/internal/webrtc"
 	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
 )
 
 func main() {
+	cfg := loadConfig()
+
+	logger, err := logging.New(os.Stderr, logging.Options{
+		Level:  cfg.Log.Level,
+		Format: cfg.Log.Format,
+	})
+	if err != nil {
+		log.Fatalf("invalid logging config: %v", err)
+	}
+	slog.SetDefault(logger)
+	webrtc.RouteFFmpegLogs(logger)
+
+	inference, err := grpc.NewClient(cfg.Inference, logger)
+	if err != nil {
+		logger.Error("failed to create inference client", "error", err)
+		os.Exit(1)
+	}
+	defer inference.Close()
+
+	server, err := webrtc.NewSignalingServer(cfg, logger, inference)
+	if err != nil {
+		logger.Error("failed to create signaling server", "error", err)
+		os.Exit(1)
+	}
+
+	// SIGTERM 时先将 /readyz 置为未就绪，再关闭会话后退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	var wg sync.WaitGroup
-	wg.Add(2)
+	wg.Add(1)
 
 	go func() {
 		defer wg.Done()
-		webrtc.StartWebSocketServer()
+		if err := server.ListenAndServe(ctx); err != nil {
+			logger.Error("signaling server stopped", "error", err)
+			os.Exit(1)
+		}
 	}()
 
-	log.Println("Starting servers...")
+	logger.Info("Starting servers...")
 	wg.Wait()
+	logger.Info("server stopped")
+}
+
+// loadConfig 依次应用配置文件、环境变量和命令行参数，校验失败时直接退出
+func loadConfig() *config.Config {
+	var (
+		configFile  = flag.String("config", os.Getenv("CONFIG_FILE"), "path to the YAML config file")
+		printConfig = flag.Bool("print-config", false, "print the effective config and exit")
+		listen      = flag.String("listen", "", "signaling listen address, e.g. :8081")
+		tlsCert     = flag.String("tls-cert", "", "TLS certificate file for the signaling server")
+		tlsKey      = flag.String("tls-key", "", "TLS private key file for the signaling server")
+		grpcAddress = flag.String("grpc-address", "", "address of the inference gRPC server, comma separated for several")
+		codecs      = flag.String("codecs", "", "comma separated list of accepted video codecs")
+		logLevel    = flag.String("log-level", "", "log level: debug, info, warn, error")
+		logFormat   = flag.String("log-format", "", "log format: text or json")
+		debounce    = flag.Duration("debounce", 0, "period within which identical results are sent once")
+		timeout     = flag.Duration("grpc-timeout", 0, "timeout of a single inference request")
+	)
+	flag.Parse()
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.ApplyEnv()
+
+	// 只覆盖命令行中显式指定的参数
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			cfg.Signaling.Addr = *listen
+		case "tls-cert":
+			cfg.Signaling.TLS.CertFile = *tlsCert
+		case "tls-key":
+			cfg.Signaling.TLS.KeyFile = *tlsKey
+		case "grpc-address":
+			cfg.Inference.SetAddress(*grpcAddress)
+		case "codecs":
+			cfg.Codecs = strings.Split(*codecs, ",")
+		case "log-level":
+			cfg.Log.Level = *logLevel
+		case "log-format":
+			cfg.Log.Format = *logFormat
+		case "debounce":
+			cfg.Recognition.DebouncePeriod = *debounce
+		case "grpc-timeout":
+			cfg.Inference.Timeout = *timeout
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("invalid config:\n%v", err)
+	}
+
+	if *printConfig {
+		out, err := cfg.YAML()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(string(out))
+		os.Exit(0)
+	}
+	return cfg
 }
@@ -0,0 +1,36 @@
+// Package bitrate 按识别所需与节点负载计算客户端上行码率上限
+package bitrate
+
+import (
+	"github.com/haowei703/webrtc-server/internal/config"
+)
+
+// Policy 码率上限策略
+type Policy struct {
+	cfg config.BitrateConfig
+}
+
+func NewPolicy(cfg config.BitrateConfig) *Policy {
+	return &Policy{cfg: cfg}
+}
+
+// Cap 返回码率上限（比特每秒），0 表示不限制。model 为空时按 language 查找，
+// utilization 为解码容量使用率，超过 load_threshold 后线性降低到 min
+func (p *Policy) Cap(model, language string, utilization float64) int {
+	if !p.cfg.Enabled {
+		return 0
+	}
+	key := model
+	if key == "" {
+		key = language
+	}
+	limit, ok := p.cfg.Models[key]
+	if !ok {
+		limit = p.cfg.Default
+	}
+	if threshold := p.cfg.LoadThreshold; utilization > threshold && threshold < 1 {
+		factor := max(0, 1-(utilization-threshold)/(1-threshold))
+		limit = p.cfg.Min + int(float64(limit-p.cfg.Min)*factor)
+	}
+	return max(limit, p.cfg.Min)
+}
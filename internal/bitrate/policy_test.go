@@ -0,0 +1,40 @@
+package bitrate
+
+import (
+	"github.com/haowei703/webrtc-server/internal/config"
+	"testing"
+)
+
+func TestPolicyCap(t *testing.T) {
+	cfg := config.Default().Bitrate
+	cfg.Default = 800_000
+	cfg.Min = 100_000
+	cfg.LoadThreshold = 0.5
+	cfg.Models = map[string]int{"asl": 300_000, "csl": 400_000}
+	p := NewPolicy(cfg)
+
+	tests := []struct {
+		name            string
+		model, language string
+		utilization     float64
+		want            int
+	}{
+		{"default", "", "", 0, 800_000},
+		{"model", "asl", "csl", 0.2, 300_000},
+		{"language when no model", "", "csl", 0.2, 400_000},
+		{"unknown model", "other", "asl", 0, 800_000},
+		{"half way to full load", "asl", "", 0.75, 200_000},
+		{"full load", "", "", 1, 100_000},
+		{"overloaded", "", "", 1.5, 100_000},
+	}
+	for _, tt := range tests {
+		if got := p.Cap(tt.model, tt.language, tt.utilization); got != tt.want {
+			t.Errorf("%s: Cap = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	cfg.Enabled = false
+	if got := NewPolicy(cfg).Cap("asl", "", 1); got != 0 {
+		t.Errorf("disabled policy: Cap = %d, want 0", got)
+	}
+}
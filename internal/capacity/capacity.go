@@ -0,0 +1,178 @@
+// Package capacity 按编码、分辨率与帧率估算视频解码成本，决定新轨道接入、降级或拒绝
+package capacity
+
+import (
+	"errors"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"math"
+	"sync"
+)
+
+// ErrOverCapacity 降级后仍超出节点容量
+var ErrOverCapacity = errors.New("decoder capacity exhausted")
+
+// baseline 1 个成本单位对应的每秒像素数，即 640x480@30fps
+const baseline = 640 * 480 * 30
+
+// Model 节点的解码容量，并发安全
+type Model struct {
+	cfg    config.CapacityConfig
+	budget float64
+
+	mu     sync.Mutex
+	used   float64
+	tracks map[*Reservation]struct{}
+}
+
+// NewModel 创建容量模型，cfg.Budget 为 0 时按 cores × cfg.UnitsPerCore 估算
+func NewModel(cfg config.CapacityConfig, cores int) *Model {
+	budget := cfg.Budget
+	if budget == 0 {
+		budget = float64(cores) * cfg.UnitsPerCore
+	}
+	return &Model{cfg: cfg, budget: budget, tracks: make(map[*Reservation]struct{})}
+}
+
+// Cost 估算一路视频轨道的解码成本
+func (m *Model) Cost(codec string, width, height int, fps float64) float64 {
+	factor, ok := m.cfg.CodecCost[codec]
+	if !ok {
+		factor = 1
+	}
+	return factor * float64(width*height) * fps / baseline
+}
+
+// Downgrade 返回降级规格
+func (m *Model) Downgrade() config.StreamSpec {
+	return m.cfg.Downgrade
+}
+
+// Reservation 一路已接入的视频轨道占用的容量，轨道结束时需调用 Release
+type Reservation struct {
+	model *Model
+	codec string
+	// cost 当前的解码成本，full 为不降级时的成本
+	cost       float64
+	full       float64
+	downgraded bool
+}
+
+// Admit 按客户端声明或协商得到的规格估算新轨道的成本，spec 中为 0 的字段使用默认规格：
+// 容量充足时正常接入，超过 downgrade_at 时以降级规格接入，降级后仍超出容量时返回 ErrOverCapacity
+func (m *Model) Admit(codec string, spec config.StreamSpec) (*Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	def := m.cfg.Default
+	if spec.Width <= 0 || spec.Height <= 0 {
+		spec.Width, spec.Height = def.Width, def.Height
+	}
+	if spec.FPS <= 0 {
+		spec.FPS = def.FPS
+	}
+	cost := m.Cost(codec, spec.Width, spec.Height, spec.FPS)
+	r := &Reservation{model: m, codec: codec, cost: cost, full: cost}
+	if m.cfg.Enabled && m.used+r.cost > m.budget*m.cfg.DowngradeAt {
+		down := m.cfg.Downgrade
+		r.cost = m.Cost(codec, down.Width, down.Height, down.FPS)
+		r.downgraded = true
+		if m.used+r.cost > m.budget {
+			return nil, ErrOverCapacity
+		}
+	}
+	m.used += r.cost
+	m.tracks[r] = struct{}{}
+	return r, nil
+}
+
+// Update 按实际的分辨率、解码帧率与收到的帧率更新成本，返回轨道是否应当降级：
+// 节点超出容量时降级，降级的轨道在恢复解码全部帧后不超过 downgrade_at 时取消降级
+func (r *Reservation) Update(width, height int, decodedFPS, inputFPS float64) bool {
+	m := r.model
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.tracks[r]; !ok {
+		return r.downgraded
+	}
+	cost := m.Cost(r.codec, width, height, decodedFPS)
+	m.used += cost - r.cost
+	r.cost = cost
+	r.full = m.Cost(r.codec, width, height, max(inputFPS, decodedFPS))
+	if !m.cfg.Enabled {
+		return false
+	}
+	switch {
+	case !r.downgraded && m.used > m.budget:
+		r.downgraded = true
+	case r.downgraded && m.used-r.cost+r.full <= m.budget*m.cfg.DowngradeAt:
+		r.downgraded = false
+	}
+	return r.downgraded
+}
+
+// Downgraded 轨道当前是否降级
+func (r *Reservation) Downgraded() bool {
+	r.model.mu.Lock()
+	defer r.model.mu.Unlock()
+	return r.downgraded
+}
+
+// Release 释放轨道占用的容量，可重复调用
+func (r *Reservation) Release() {
+	m := r.model
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.tracks[r]; !ok {
+		return
+	}
+	delete(m.tracks, r)
+	m.used -= r.cost
+	if len(m.tracks) == 0 {
+		// 消除浮点累计误差
+		m.used = 0
+	}
+}
+
+// Utilization 返回已用成本占容量的比例，未启用容量模型时为 0
+func (m *Model) Utilization() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.cfg.Enabled || m.budget <= 0 {
+		return 0
+	}
+	return m.used / m.budget
+}
+
+// Status 当前容量，供管理接口与健康检查使用
+type Status struct {
+	Enabled    bool    `json:"enabled"`
+	Budget     float64 `json:"budget"`
+	Used       float64 `json:"used"`
+	Available  float64 `json:"available"`
+	Tracks     int     `json:"tracks"`
+	Downgraded int     `json:"downgraded"`
+	// Saturated 已用成本超过 downgrade_at，新轨道将以降级规格接入
+	Saturated bool `json:"saturated"`
+}
+
+func (m *Model) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := Status{
+		Enabled:   m.cfg.Enabled,
+		Budget:    round(m.budget),
+		Used:      round(m.used),
+		Available: round(max(0, m.budget-m.used)),
+		Tracks:    len(m.tracks),
+		Saturated: m.cfg.Enabled && m.used > m.budget*m.cfg.DowngradeAt,
+	}
+	for r := range m.tracks {
+		if r.downgraded {
+			s.Downgraded++
+		}
+	}
+	return s
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
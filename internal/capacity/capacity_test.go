@@ -0,0 +1,124 @@
+package capacity
+
+import (
+	"errors"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"testing"
+)
+
+func newTestModel(budget float64) *Model {
+	cfg := config.Default().Capacity
+	cfg.Budget = budget
+	cfg.Downgrade = config.StreamSpec{Width: 320, Height: 240, FPS: 15}
+	return NewModel(cfg, 1)
+}
+
+func TestCost(t *testing.T) {
+	m := newTestModel(10)
+	if got := m.Cost("VP8", 640, 480, 30); got != 1 {
+		t.Errorf("VP8 480p30 cost = %v, want 1", got)
+	}
+	if got := m.Cost("H265", 1280, 720, 30); got != 6 {
+		t.Errorf("H265 720p30 cost = %v, want 6", got)
+	}
+	if got := m.Cost("AV1", 320, 240, 15); got != 0.125 {
+		t.Errorf("unknown codec cost = %v, want 0.125", got)
+	}
+}
+
+func TestAdmitDowngradesThenRejects(t *testing.T) {
+	// downgrade_at 0.8：前 3 路正常接入，之后以 0.125 的降级成本接入直到 4
+	m := newTestModel(4)
+	var reservations []*Reservation
+	for i := 0; i < 3; i++ {
+		r, err := m.Admit("VP8", config.StreamSpec{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Downgraded() {
+			t.Fatalf("track %d downgraded below downgrade_at", i)
+		}
+		reservations = append(reservations, r)
+	}
+	for i := 0; i < 8; i++ {
+		r, err := m.Admit("VP8", config.StreamSpec{})
+		if err != nil {
+			t.Fatalf("downgraded track %d: %v", i, err)
+		}
+		if !r.Downgraded() {
+			t.Fatalf("track %d not downgraded above downgrade_at", i)
+		}
+	}
+	if _, err := m.Admit("VP8", config.StreamSpec{}); !errors.Is(err, ErrOverCapacity) {
+		t.Fatalf("got %v, want %v", err, ErrOverCapacity)
+	}
+
+	if got := m.Utilization(); got != 1 {
+		t.Fatalf("utilization = %v, want 1", got)
+	}
+	status := m.Status()
+	if status.Tracks != 11 || status.Downgraded != 8 || status.Used != 4 || !status.Saturated {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	for _, r := range reservations {
+		r.Release()
+		r.Release()
+	}
+	if status := m.Status(); status.Used != 1 || status.Tracks != 8 {
+		t.Fatalf("unexpected status after release %+v", status)
+	}
+}
+
+func TestAdmitUsesAnnouncedSpec(t *testing.T) {
+	m := newTestModel(4)
+	// 720p30 的成本为 3，未超过 downgrade_at
+	a, err := m.Admit("VP8", config.StreamSpec{Width: 1280, Height: 720, FPS: 30})
+	if err != nil || a.Downgraded() {
+		t.Fatalf("720p track: err %v, downgraded %v", err, a.Downgraded())
+	}
+	// 只声明帧率时分辨率按默认规格估算：1 + 3 超过 downgrade_at
+	b, err := m.Admit("VP8", config.StreamSpec{FPS: 30})
+	if err != nil || !b.Downgraded() {
+		t.Fatalf("second track: err %v, downgraded %v", err, b.Downgraded())
+	}
+}
+
+func TestUpdateDowngradesOnOverload(t *testing.T) {
+	m := newTestModel(4)
+	a, _ := m.Admit("VP8", config.StreamSpec{})
+	b, _ := m.Admit("VP8", config.StreamSpec{})
+
+	// 客户端实际发送 720p，节点超出容量
+	if a.Update(1280, 720, 30, 30) {
+		t.Fatal("downgraded while within budget")
+	}
+	if !b.Update(1280, 720, 30, 30) {
+		t.Fatal("not downgraded while over budget")
+	}
+	// 降级后只解码关键帧，但恢复解码全部帧仍会超过 downgrade_at
+	if !b.Update(1280, 720, 3, 30) {
+		t.Fatal("downgrade lifted while node is still loaded")
+	}
+	a.Update(640, 480, 30, 30)
+	if !b.Update(1280, 720, 3, 30) {
+		t.Fatal("downgrade lifted while the full 720p stream would exceed downgrade_at")
+	}
+	// 码率受限后客户端降低分辨率
+	if b.Update(640, 480, 3, 30) {
+		t.Fatal("still downgraded after load dropped")
+	}
+}
+
+func TestDisabledAdmitsEverything(t *testing.T) {
+	cfg := config.Default().Capacity
+	cfg.Enabled = false
+	cfg.Budget = 1
+	m := NewModel(cfg, 1)
+	for i := 0; i < 5; i++ {
+		r, err := m.Admit("H265", config.StreamSpec{})
+		if err != nil || r.Downgraded() {
+			t.Fatalf("track %d: err %v, downgraded %v", i, err, r.Downgraded())
+		}
+	}
+}
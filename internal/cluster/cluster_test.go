@@ -0,0 +1,134 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/haowei703/webrtc-server/internal/cluster/clustertest"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRedis(t *testing.T, password string) config.RedisConfig {
+	t.Helper()
+	server, err := clustertest.NewRedis(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	cfg := config.Default().Cluster.Redis
+	cfg.Address = server.Addr()
+	cfg.Password = password
+	return cfg
+}
+
+func TestDirectories(t *testing.T) {
+	directories := map[string]Directory{
+		"memory": NewMemory(),
+		"redis":  NewRedis(newTestRedis(t, "secret")),
+	}
+	ctx := context.Background()
+	owner := Owner{Node: "node-a", URL: "http://10.0.0.1:8081"}
+	for name, dir := range directories {
+		t.Run(name, func(t *testing.T) {
+			defer dir.Close()
+			if _, err := dir.Lookup(ctx, "token/missing"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("lookup missing key: got %v, want %v", err, ErrNotFound)
+			}
+			if err := dir.Register(ctx, "token/a", owner, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			got, err := dir.Lookup(ctx, "token/a")
+			if err != nil || got != owner {
+				t.Fatalf("lookup: got %+v, %v", got, err)
+			}
+			if err := dir.Register(ctx, "token/short", owner, 50*time.Millisecond); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(100 * time.Millisecond)
+			if _, err := dir.Lookup(ctx, "token/short"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("expired key: got %v, want %v", err, ErrNotFound)
+			}
+			if err := dir.Unregister(ctx, "token/a"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := dir.Lookup(ctx, "token/a"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("unregistered key: got %v, want %v", err, ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestRedisAuthFailure(t *testing.T) {
+	cfg := newTestRedis(t, "secret")
+	cfg.Password = "wrong"
+	dir := NewRedis(cfg)
+	defer dir.Close()
+	if err := dir.Register(context.Background(), "token/a", Owner{}, time.Minute); err == nil || !strings.Contains(err.Error(), "AUTH") {
+		t.Fatalf("expected AUTH error, got %v", err)
+	}
+}
+
+func TestNewDirectoryChecksRedis(t *testing.T) {
+	cfg := config.Default().Cluster
+	cfg.Directory = "redis"
+	cfg.Redis = newTestRedis(t, "secret")
+	cfg.Redis.Password = "wrong"
+	if _, err := NewDirectory(context.Background(), cfg); err == nil {
+		t.Fatal("expected an error for a rejected password")
+	}
+	cfg.Redis.Password = "secret"
+	dir, err := NewDirectory(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = dir.Close()
+}
+
+func TestForwardProxiesWebSocket(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(ForwardedHeader) != "node-b" || r.URL.Query().Get("resume") != "abc" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.WriteMessage(websocket.TextMessage, []byte("owned"))
+	}))
+	defer owner.Close()
+
+	f := &Forwarder{Node: "node-b", Mode: "redirect", Logger: slog.Default()}
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.Forward(w, r, Owner{Node: "node-a", URL: owner.URL})
+	}))
+	defer front.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(front.URL, "http")+"/ws/signaling?resume=abc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, data, err := conn.ReadMessage()
+	if err != nil || string(data) != "owned" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+}
+
+func TestForwardRedirectsHTTP(t *testing.T) {
+	f := &Forwarder{Node: "node-b", Mode: "redirect", Logger: slog.Default()}
+	req := httptest.NewRequest(http.MethodGet, "/admin/sessions/s1?x=1", nil)
+	rec := httptest.NewRecorder()
+	f.Forward(rec, req, Owner{Node: "node-a", URL: "http://10.0.0.1:8081"})
+	if rec.Code != http.StatusTemporaryRedirect || rec.Header().Get("Location") != "http://10.0.0.1:8081/admin/sessions/s1?x=1" {
+		t.Fatalf("got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,177 @@
+// Package clustertest 提供进程内的 Redis 兼容服务，用于不依赖 Redis 的会话目录测试
+package clustertest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redis 只实现会话目录用到的命令：PING、AUTH、SELECT、SET [PX]、GET、DEL
+type Redis struct {
+	password string
+	lis      net.Listener
+	mu       sync.Mutex
+	data     map[string]entry
+	now      func() time.Time
+}
+
+type entry struct {
+	value   string
+	expires time.Time
+}
+
+// NewRedis 在 127.0.0.1 的随机端口上启动服务，password 非空时要求客户端先 AUTH
+func NewRedis(password string) (*Redis, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	r := &Redis{password: password, lis: lis, data: make(map[string]entry), now: time.Now}
+	go r.serve()
+	return r, nil
+}
+
+// Addr 用于 cluster.redis.address 的地址
+func (r *Redis) Addr() string {
+	return r.lis.Addr().String()
+}
+
+// Keys 返回未过期的全部键
+func (r *Redis) Keys() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []string
+	for k, e := range r.data {
+		if e.expires.IsZero() || r.now().Before(e.expires) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (r *Redis) Close() {
+	_ = r.lis.Close()
+}
+
+func (r *Redis) serve() {
+	for {
+		conn, err := r.lis.Accept()
+		if err != nil {
+			return
+		}
+		go r.handle(conn)
+	}
+}
+
+func (r *Redis) handle(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	authed := r.password == ""
+	for {
+		args, err := readCommand(rd)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		var reply string
+		switch {
+		case cmd == "AUTH":
+			if len(args) == 2 && args[1] == r.password {
+				authed = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		default:
+			reply = r.exec(cmd, args[1:])
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (r *Redis) exec(cmd string, args []string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch cmd {
+	case "PING":
+		return "+PONG\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "SET":
+		if len(args) != 2 && len(args) != 4 {
+			return "-ERR syntax error\r\n"
+		}
+		e := entry{value: args[1]}
+		if len(args) == 4 {
+			ms, err := strconv.ParseInt(args[3], 10, 64)
+			if err != nil || strings.ToUpper(args[2]) != "PX" || ms <= 0 {
+				return "-ERR syntax error\r\n"
+			}
+			e.expires = r.now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		r.data[args[0]] = e
+		return "+OK\r\n"
+	case "GET":
+		if len(args) != 1 {
+			return "-ERR wrong number of arguments\r\n"
+		}
+		e, ok := r.data[args[0]]
+		if !ok || (!e.expires.IsZero() && !r.now().Before(e.expires)) {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(e.value), e.value)
+	case "DEL":
+		n := 0
+		for _, k := range args {
+			if _, ok := r.data[k]; ok {
+				delete(r.data, k)
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", cmd)
+	}
+}
+
+// readCommand 读取一条以 RESP 数组编码的命令
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid array length %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
@@ -0,0 +1,97 @@
+// Package cluster 实现多实例部署时的会话目录与请求转发
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"sync"
+	"time"
+)
+
+// ErrNotFound 目录中没有该记录或记录已过期
+var ErrNotFound = errors.New("session not found in directory")
+
+// Owner 会话所在的实例
+type Owner struct {
+	Node string `json:"node"`
+	// URL 该实例信令服务的地址
+	URL string `json:"url"`
+}
+
+// Directory 会话目录，记录会话所在的实例；key 由调用方区分类型，例如 "token/<resume token>"
+type Directory interface {
+	Register(ctx context.Context, key string, owner Owner, ttl time.Duration) error
+	Lookup(ctx context.Context, key string) (Owner, error)
+	Unregister(ctx context.Context, key string) error
+	Close() error
+}
+
+// NewDirectory 按配置创建会话目录，Redis 无法连接或认证失败时返回错误
+func NewDirectory(ctx context.Context, cfg config.ClusterConfig) (Directory, error) {
+	switch cfg.Directory {
+	case "memory":
+		return NewMemory(), nil
+	case "redis":
+		dir := NewRedis(cfg.Redis)
+		if err := dir.Ping(ctx); err != nil {
+			_ = dir.Close()
+			return nil, err
+		}
+		return dir, nil
+	default:
+		return nil, fmt.Errorf("unknown session directory %q", cfg.Directory)
+	}
+}
+
+// Memory 进程内的会话目录，仅适用于单实例
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	now     func() time.Time
+}
+
+type memoryEntry struct {
+	owner   Owner
+	expires time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string]memoryEntry), now: time.Now}
+}
+
+func (m *Memory) Register(_ context.Context, key string, owner Owner, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	// 顺带清理过期记录
+	for k, e := range m.entries {
+		if !now.Before(e.expires) {
+			delete(m.entries, k)
+		}
+	}
+	m.entries[key] = memoryEntry{owner: owner, expires: now.Add(ttl)}
+	return nil
+}
+
+func (m *Memory) Lookup(_ context.Context, key string) (Owner, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok || !m.now().Before(e.expires) {
+		return Owner{}, ErrNotFound
+	}
+	return e.owner, nil
+}
+
+func (m *Memory) Unregister(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,56 @@
+package cluster
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// ForwardedHeader 实例间转发时携带转发方的实例标识，收到该请求的实例不再转发，避免循环
+const ForwardedHeader = "X-Webrtc-Forwarded-By"
+
+// Forwarder 将请求转发到会话所在的实例
+type Forwarder struct {
+	// Node 本实例标识
+	Node string
+	// Mode proxy 或 redirect，WebSocket 升级请求总是代理
+	Mode   string
+	Logger *slog.Logger
+}
+
+// Forwarded 请求是否已由其他实例转发
+func Forwarded(r *http.Request) bool {
+	return r.Header.Get(ForwardedHeader) != ""
+}
+
+// Forward 按 Mode 代理或重定向请求到 owner
+func (f *Forwarder) Forward(w http.ResponseWriter, r *http.Request, owner Owner) {
+	target, err := url.Parse(owner.URL)
+	if err != nil {
+		f.Logger.Warn("invalid owner URL in session directory", "node", owner.Node, "url", owner.URL, "error", err)
+		http.Error(w, "session owner unreachable", http.StatusBadGateway)
+		return
+	}
+	if f.Mode == "redirect" && !isWebSocketUpgrade(r) {
+		u := *target
+		u.Path, u.RawQuery = r.URL.Path, r.URL.RawQuery
+		http.Redirect(w, r, u.String(), http.StatusTemporaryRedirect)
+		return
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		req.Header.Set(ForwardedHeader, f.Node)
+	}
+	proxy.ErrorLog = slog.NewLogLogger(f.Logger.Handler(), slog.LevelWarn)
+	f.Logger.Debug("forwarding request to session owner", "node", owner.Node, "path", r.URL.Path)
+	proxy.ServeHTTP(w, r)
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
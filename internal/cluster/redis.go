@@ -0,0 +1,193 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Redis 基于 Redis 兼容服务的会话目录，只使用 SET PX、GET 与 DEL，
+// 命令在单个连接上串行执行，连接出错后在下一条命令时重连
+type Redis struct {
+	cfg config.RedisConfig
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func NewRedis(cfg config.RedisConfig) *Redis {
+	return &Redis{cfg: cfg}
+}
+
+// Ping 检查连接、认证与选库是否成功
+func (r *Redis) Ping(ctx context.Context) error {
+	_, err := r.do(ctx, "PING")
+	return err
+}
+
+func (r *Redis) Register(ctx context.Context, key string, owner Owner, ttl time.Duration) error {
+	value, err := json.Marshal(owner)
+	if err != nil {
+		return err
+	}
+	_, err = r.do(ctx, "SET", r.cfg.KeyPrefix+key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (r *Redis) Lookup(ctx context.Context, key string) (Owner, error) {
+	reply, err := r.do(ctx, "GET", r.cfg.KeyPrefix+key)
+	if err != nil {
+		return Owner{}, err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return Owner{}, ErrNotFound
+	}
+	var owner Owner
+	if err := json.Unmarshal([]byte(value), &owner); err != nil {
+		return Owner{}, fmt.Errorf("invalid directory entry for %s: %w", key, err)
+	}
+	return owner, nil
+}
+
+func (r *Redis) Unregister(ctx context.Context, key string) error {
+	_, err := r.do(ctx, "DEL", r.cfg.KeyPrefix+key)
+	return err
+}
+
+func (r *Redis) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn, r.rd = nil, nil
+	return err
+}
+
+// redisError 服务端返回的错误回复，不影响连接
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// do 执行一条命令，返回 string、int64、nil 或 []any
+func (r *Redis) do(ctx context.Context, args ...string) (any, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+
+	if r.conn == nil {
+		if err := r.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := r.roundTrip(ctx, args)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		// 连接状态未知，丢弃后下次重连
+		_ = r.conn.Close()
+		r.conn, r.rd = nil, nil
+	}
+	return reply, err
+}
+
+// connect 建立连接并完成认证与选库，调用方需持有 mu
+func (r *Redis) connect(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", r.cfg.Address)
+	if err != nil {
+		return fmt.Errorf("connect to redis %s: %w", r.cfg.Address, err)
+	}
+	r.conn, r.rd = conn, bufio.NewReader(conn)
+	var setup [][]string
+	if r.cfg.Password != "" {
+		setup = append(setup, []string{"AUTH", r.cfg.Password})
+	}
+	if r.cfg.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(r.cfg.DB)})
+	}
+	for _, args := range setup {
+		if _, err := r.roundTrip(ctx, args); err != nil {
+			_ = conn.Close()
+			r.conn, r.rd = nil, nil
+			return fmt.Errorf("redis %s: %w", args[0], err)
+		}
+	}
+	return nil
+}
+
+func (r *Redis) roundTrip(ctx context.Context, args []string) (any, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = r.conn.SetDeadline(deadline)
+	}
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	if _, err := r.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readReply(r.rd)
+}
+
+// readReply 解析一条 RESP2 回复
+func readReply(rd *bufio.Reader) (any, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(rd); err != nil {
+				var replyErr redisError
+				if !errors.As(err, &replyErr) {
+					return nil, err
+				}
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+	}
+}
@@ -0,0 +1,862 @@
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/logging"
+	"github.com/haowei703/webrtc-server/internal/tlsutil"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config 服务端完整配置，加载顺序为：默认值 -> 配置文件 -> 环境变量 -> 命令行参数
+type Config struct {
+	Log         LogConfig         `yaml:"log"`
+	Signaling   SignalingConfig   `yaml:"signaling"`
+	ICE         ICEConfig         `yaml:"ice"`
+	Codecs      []string          `yaml:"codecs"`
+	Decoder     DecoderConfig     `yaml:"decoder"`
+	Inference   InferenceConfig   `yaml:"inference"`
+	Recognition RecognitionConfig `yaml:"recognition"`
+	Sinks       SinksConfig       `yaml:"sinks"`
+	Recording   RecordingConfig   `yaml:"recording"`
+	Limits      LimitsConfig      `yaml:"limits"`
+	Capacity    CapacityConfig    `yaml:"capacity"`
+	Cluster     ClusterConfig     `yaml:"cluster"`
+	Bitrate     BitrateConfig     `yaml:"bitrate"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+type SignalingConfig struct {
+	Addr string    `yaml:"addr"`
+	Path string    `yaml:"path"`
+	TLS  TLSConfig `yaml:"tls"`
+	// DataChannel 客户端打开该标签的 DataChannel 后识别结果改由其下发，为空表示只使用 WebSocket
+	DataChannel string `yaml:"data_channel"`
+	// ResumeGrace 信令断开后会话保留的时长，期间客户端可凭 resume token 重连，0 表示断开即结束会话
+	ResumeGrace time.Duration `yaml:"resume_grace"`
+	// PingInterval 向客户端发送 ping 的间隔，需小于 PongWait
+	PingInterval time.Duration `yaml:"ping_interval"`
+	// PongWait 超过该时长未收到任何消息或 pong 视为信令断开
+	PongWait time.Duration `yaml:"pong_wait"`
+	// WriteWait 单条信令消息的写超时
+	WriteWait time.Duration `yaml:"write_wait"`
+	// MaxMessageSize 客户端信令消息的最大字节数，超出时以 1009 关闭连接
+	MaxMessageSize int64 `yaml:"max_message_size"`
+	// IdleTimeout 会话在该时长内没有信令消息、DataChannel 消息与媒体数据时结束，0 表示不限制
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// ShutdownDelay 收到退出信号后 /readyz 先返回 503 的时长，便于负载均衡摘除节点
+	ShutdownDelay time.Duration `yaml:"shutdown_delay"`
+	// ShutdownTimeout 停止监听并关闭全部会话后，等待清理完成的最长时间
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	Admin           AdminConfig   `yaml:"admin"`
+}
+
+// AdminConfig /admin 接口的访问控制，Token 与 ClientCerts 都未配置时 /admin 接口一律返回 403
+type AdminConfig struct {
+	// Token 请求头 Authorization: Bearer <token>，集群模式下实例间代理的 /admin 请求只能以此认证
+	Token string `yaml:"token"`
+	// ClientCerts 允许访问的已校验客户端证书名称
+	ClientCerts []string `yaml:"client_certs"`
+}
+
+// LimitsConfig 信令的会话数与消息速率限制，各字段为 0 表示不限制
+type LimitsConfig struct {
+	// MaxSessions 全局并发会话上限，达到后新连接收到 server_busy 错误
+	MaxSessions int `yaml:"max_sessions"`
+	// PerIP 按客户端 IP 限制
+	PerIP QuotaConfig `yaml:"per_ip"`
+	// PerIdentity 按已校验的客户端证书名称或 Tokens 中的身份限制，两者都没有的连接只受 PerIP 限制
+	PerIdentity QuotaConfig `yaml:"per_identity"`
+	// Tokens 无法出示客户端证书的客户端（如浏览器）通过 ?token= 声明身份
+	Tokens []IdentityToken `yaml:"tokens"`
+}
+
+// IdentityToken 一个客户端身份，Name 与客户端证书名称共用 per_identity 配额
+type IdentityToken struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+}
+
+type QuotaConfig struct {
+	// MaxSessions 并发会话上限，信令断开但仍在 resume_grace 内的会话也计入
+	MaxSessions int `yaml:"max_sessions"`
+	// SessionsPerMinute 每分钟新建会话数上限
+	SessionsPerMinute int `yaml:"sessions_per_minute"`
+	// MessageRate 每秒信令消息数上限（WebSocket 与 DataChannel 合计），MessageBurst 为允许的突发量
+	MessageRate  float64 `yaml:"message_rate"`
+	MessageBurst int     `yaml:"message_burst"`
+}
+
+func (c QuotaConfig) Validate() error {
+	if c.MaxSessions < 0 || c.SessionsPerMinute < 0 || c.MessageRate < 0 || c.MessageBurst < 0 {
+		return errors.New("limits must not be negative")
+	}
+	if c.MessageRate > 0 && c.MessageBurst < 1 {
+		return errors.New("message_burst must be at least 1 when message_rate is set")
+	}
+	return nil
+}
+
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ReloadInterval 检查证书文件变化的间隔，0 表示不热加载
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+	// ClientCAFile 用于校验内部客户端证书的 CA
+	ClientCAFile string `yaml:"client_ca_file"`
+	// ClientAuth 客户端证书校验模式：none, request, verify_if_given, require
+	ClientAuth string `yaml:"client_auth"`
+	// RedirectAddr 非空时在该地址上监听 HTTP 并重定向到 HTTPS
+	RedirectAddr string `yaml:"redirect_addr"`
+}
+
+// Enabled 证书与私钥都配置时启用 TLS
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+type ICEConfig struct {
+	Servers []ICEServer `yaml:"servers"`
+	// RestartDelay ICE 进入 disconnected 后等待自行恢复的时长，超过后由服务端发起 ICE restart，
+	// 进入 failed 时立即发起
+	RestartDelay time.Duration `yaml:"restart_delay"`
+	// FailureTimeout ICE 断开后在该时长内未恢复则结束会话
+	FailureTimeout time.Duration `yaml:"failure_timeout"`
+}
+
+type ICEServer struct {
+	URLs       []string `yaml:"urls"`
+	Username   string   `yaml:"username,omitempty"`
+	Credential string   `yaml:"credential,omitempty"`
+}
+
+type DecoderConfig struct {
+	// PixelFormat 解码后送往下游的像素格式：rgba 或 rgb24
+	PixelFormat string `yaml:"pixel_format"`
+}
+
+// ClusterConfig 多实例部署时的会话目录，用于将恢复会话与会话管理请求转发到会话所在的实例
+type ClusterConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// NodeID 实例标识，为空时使用主机名
+	NodeID string `yaml:"node_id"`
+	// AdvertiseURL 其他实例访问本实例信令服务的地址，例如 http://10.0.0.5:8081
+	AdvertiseURL string `yaml:"advertise_url"`
+	// Directory 会话目录：memory 仅适用于单实例，redis 在实例间共享
+	Directory string      `yaml:"directory"`
+	Redis     RedisConfig `yaml:"redis"`
+	// Forward 请求落到非会话所在实例时的处理方式：proxy 由本实例代理，
+	// redirect 返回 307 重定向（WebSocket 无法跟随重定向，仍然代理）
+	Forward string `yaml:"forward"`
+	// TTL 目录记录的有效期，实例定期刷新，实例异常退出后其记录在 TTL 后失效
+	TTL time.Duration `yaml:"ttl"`
+}
+
+type RedisConfig struct {
+	Address   string `yaml:"address"`
+	Password  string `yaml:"password,omitempty"`
+	DB        int    `yaml:"db"`
+	KeyPrefix string `yaml:"key_prefix"`
+	// Timeout 单条命令的超时
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// SupportedDirectories 会话目录的实现
+var SupportedDirectories = []string{"memory", "redis"}
+
+// BitrateConfig 客户端上行码率上限，通过 REMB 下发，码率均为比特每秒
+type BitrateConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Default 未在 Models 中列出的模型的码率上限
+	Default int `yaml:"default"`
+	// Models 按客户端选择的模型（未选择模型时为手语种类）配置码率上限，按模型所需的输入分辨率与帧率设置
+	Models map[string]int `yaml:"models"`
+	// LoadThreshold 解码容量使用率超过该值后按比例降低上限，使用率达到 100% 时降到 Min
+	LoadThreshold float64 `yaml:"load_threshold"`
+	Min           int     `yaml:"min"`
+	// Interval 发送 REMB 的间隔，客户端的带宽估计会逐步上探，需要持续发送
+	Interval time.Duration `yaml:"interval"`
+}
+
+// CapacityConfig 解码容量模型，成本以 1 路 640x480@30fps 的 VP8 为 1 个单位
+type CapacityConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Budget 节点可承载的成本，0 表示按 CPU 核数 × UnitsPerCore 估算
+	Budget       float64 `yaml:"budget"`
+	UnitsPerCore float64 `yaml:"units_per_core"`
+	// DowngradeAt 已用成本占 Budget 的比例超过该值后，新轨道以降级规格接入
+	DowngradeAt float64 `yaml:"downgrade_at"`
+	// CodecCost 各编码相对 VP8 的解码成本，未列出的编码按 1 计算
+	CodecCost map[string]float64 `yaml:"codec_cost"`
+	// Default 客户端未通过 ?video= 或 SDP 声明分辨率与帧率时，按该规格估算新轨道的成本
+	Default StreamSpec `yaml:"default"`
+	// Downgrade 降级后的规格：通过 REMB 将码率限制为 Bitrate，只解码关键帧并按 FPS 向客户端请求关键帧，
+	// 浏览器通常每 300ms 最多响应一次关键帧请求
+	Downgrade StreamSpec `yaml:"downgrade"`
+}
+
+// StreamSpec 视频流规格
+type StreamSpec struct {
+	Width  int     `yaml:"width"`
+	Height int     `yaml:"height"`
+	FPS    float64 `yaml:"fps"`
+	// Bitrate 比特每秒，仅用于降级规格
+	Bitrate int `yaml:"bitrate"`
+}
+
+type InferenceConfig struct {
+	// Address 单个推理服务地址，Endpoints 为空时使用
+	Address string `yaml:"address"`
+	// Endpoints 多个推理服务地址，"dns:///host:port" 表示使用 DNS 解析出的全部地址
+	Endpoints []string `yaml:"endpoints,omitempty"`
+	// Models 模型 ID（客户端未指定模型时为手语种类）到推理服务地址的映射，未列出的模型发往 Address/Endpoints
+	Models map[string][]string `yaml:"models,omitempty"`
+	// Balancer 负载均衡策略：round_robin 或 least_outstanding
+	Balancer string `yaml:"balancer"`
+	// Sticky 同一会话的帧固定发往同一推理服务，便于时序模型保持上下文
+	Sticky bool `yaml:"sticky"`
+	// MaxAttempts 单帧最多尝试的推理服务数量，大于 1 时失败会切换到其他服务
+	MaxAttempts int `yaml:"max_attempts"`
+	// ResolveInterval DNS 地址的重新解析间隔
+	ResolveInterval time.Duration      `yaml:"resolve_interval"`
+	Ejection        EjectionConfig     `yaml:"ejection"`
+	Timeout         time.Duration      `yaml:"timeout"`
+	TLS             InferenceTLSConfig `yaml:"tls"`
+	// AuthToken 以 "authorization: Bearer <token>" 元数据随每次调用发送
+	AuthToken string `yaml:"auth_token,omitempty"`
+	// AuthTokenFile 从文件读取 AuthToken，优先级高于 AuthToken
+	AuthTokenFile string `yaml:"auth_token_file,omitempty"`
+}
+
+// EjectionConfig 连续失败的推理服务会被暂时移出负载均衡
+type EjectionConfig struct {
+	// ConsecutiveFailures 触发移出的连续失败次数，0 表示不移出
+	ConsecutiveFailures int           `yaml:"consecutive_failures"`
+	Duration            time.Duration `yaml:"duration"`
+}
+
+// Targets 返回配置的全部推理服务地址
+func (c InferenceConfig) Targets() []string {
+	if len(c.Endpoints) > 0 {
+		return c.Endpoints
+	}
+	return []string{c.Address}
+}
+
+// SetAddress 用环境变量或命令行参数覆盖配置文件中的推理服务地址，逗号分隔时视为多个推理服务
+func (c *InferenceConfig) SetAddress(v string) {
+	if strings.Contains(v, ",") {
+		c.Endpoints = strings.Split(v, ",")
+	} else {
+		c.Address = v
+		c.Endpoints = nil
+	}
+}
+
+type InferenceTLSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// CAFile 校验推理服务证书的 CA，为空时使用系统证书
+	CAFile string `yaml:"ca_file"`
+	// CertFile 与 KeyFile 为 mTLS 使用的客户端证书
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ServerName 覆盖证书校验使用的服务名
+	ServerName     string        `yaml:"server_name"`
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+type RecognitionConfig struct {
+	// DebouncePeriod 相同识别结果在该时间窗口内只下发一次
+	DebouncePeriod time.Duration `yaml:"debounce_period"`
+	// EmptyResult 推理服务表示"无结果"的返回值，不会下发给客户端
+	EmptyResult string `yaml:"empty_result"`
+	// Filters debounce 模式下依次应用的结果过滤器，为空时使用 debounce_period 的去重，
+	// 客户端可以在建立会话时通过 ?filters= 为本会话指定；sentence 模式下不能配置
+	Filters []FilterConfig `yaml:"filters"`
+	// Mode 结果下发方式：debounce 逐个手语词去抖后下发，sentence 聚合为句子并区分中间结果与最终结果
+	Mode       string           `yaml:"mode"`
+	Aggregator AggregatorConfig `yaml:"aggregator"`
+}
+
+// FilterConfig 一个识别结果过滤器，Type 决定使用哪些参数：
+// dedup 使用 Period，consecutive 使用 Count，confidence 使用 Min，hysteresis 使用 Enter 与 Exit
+type FilterConfig struct {
+	Type   string        `yaml:"type"`
+	Period time.Duration `yaml:"period,omitempty"`
+	Count  int           `yaml:"count,omitempty"`
+	Min    float64       `yaml:"min,omitempty"`
+	Enter  float64       `yaml:"enter,omitempty"`
+	Exit   float64       `yaml:"exit,omitempty"`
+}
+
+// Validate 检查过滤器参数，客户端指定的过滤器同样经过该检查
+func (f FilterConfig) Validate() error {
+	switch f.Type {
+	case "dedup":
+		if f.Period < 0 || f.Period > time.Minute {
+			return fmt.Errorf("dedup period %s must be between 0 and 1m", f.Period)
+		}
+	case "consecutive":
+		if f.Count < 1 || f.Count > 100 {
+			return fmt.Errorf("consecutive count %d must be between 1 and 100", f.Count)
+		}
+	case "confidence":
+		if f.Min < 0 || f.Min > 1 {
+			return fmt.Errorf("confidence min %v must be between 0 and 1", f.Min)
+		}
+	case "hysteresis":
+		if f.Exit < 0 || f.Enter > 1 || f.Exit > f.Enter {
+			return fmt.Errorf("hysteresis requires 0 <= exit <= enter <= 1, got enter %v exit %v", f.Enter, f.Exit)
+		}
+	default:
+		return fmt.Errorf("unknown filter type %q", f.Type)
+	}
+	return nil
+}
+
+// AggregatorConfig sentence 模式下的结果聚合参数
+type AggregatorConfig struct {
+	// Window 投票使用的滑动窗口
+	Window time.Duration `yaml:"window"`
+	// VoteThreshold 窗口内某个词的置信度之和占全部置信度的比例达到该值才被认定
+	VoteThreshold float64 `yaml:"vote_threshold"`
+	// MinFrames 认定一个词至少需要的帧数
+	MinFrames int `yaml:"min_frames"`
+	// MinConfidence 低于该置信度的结果视为无结果
+	MinConfidence float64 `yaml:"min_confidence"`
+	// SignGap 持续无结果达到该时长视为一个手语词结束
+	SignGap time.Duration `yaml:"sign_gap"`
+	// SentenceGap 持续无结果达到该时长视为一句话结束，下发最终结果
+	SentenceGap time.Duration `yaml:"sentence_gap"`
+	// MaxWords 一句话的最大词数，达到后立即下发最终结果，0 表示不限制
+	MaxWords int `yaml:"max_words"`
+	// Separator 拼接句子时词之间的分隔符
+	Separator string `yaml:"separator"`
+}
+
+const redactedValue = "******"
+
+// SinksConfig 解码后视频帧的去向，客户端可通过 ?sinks=a,b 在 Allowed 范围内选择
+type SinksConfig struct {
+	Default   []string        `yaml:"default"`
+	Allowed   []string        `yaml:"allowed"`
+	Thumbnail ThumbnailConfig `yaml:"thumbnail"`
+	Dataset   DatasetConfig   `yaml:"dataset"`
+}
+
+type ThumbnailConfig struct {
+	Dir      string        `yaml:"dir"`
+	Interval time.Duration `yaml:"interval"`
+	// Width 缩略图宽度，高度按比例计算
+	Width int `yaml:"width"`
+}
+
+// DatasetConfig 导出带识别结果标注的训练数据，只对携带 ?consent=dataset 的会话生效
+type DatasetConfig struct {
+	Dir string `yaml:"dir"`
+	// Format 帧的保存格式：png、jpeg 或 npz（每个轨道一个 npz 文件）
+	Format string `yaml:"format"`
+	// Interval 采样间隔
+	Interval time.Duration `yaml:"interval"`
+	// MaxFramesPerSession 每个轨道最多导出的帧数，0 表示不限制
+	MaxFramesPerSession int             `yaml:"max_frames_per_session"`
+	Retention           RetentionConfig `yaml:"retention"`
+}
+
+// RetentionConfig 导出数据的保留策略，超出限制时从最早的会话开始删除
+type RetentionConfig struct {
+	// MaxAge 会话目录的最长保留时间，0 表示不限制
+	MaxAge time.Duration `yaml:"max_age"`
+	// MaxTotalSize 导出目录的总大小上限（字节），0 表示不限制
+	MaxTotalSize int64 `yaml:"max_total_size"`
+}
+
+// RecordingConfig 将客户端发送的原始音视频写入磁盘，用于模型训练与纠纷处理
+type RecordingConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"`
+	// MaxFileSize 单个文件的大小上限（字节），视频在超出后的下一个关键帧处切分，0 表示不限制
+	MaxFileSize int64 `yaml:"max_file_size"`
+	// MaxFileDuration 单个文件的时长上限，0 表示不限制
+	MaxFileDuration time.Duration `yaml:"max_file_duration"`
+	// Audio 是否同时录制 Opus 音频
+	Audio bool `yaml:"audio"`
+	// Results 是否将识别结果写入同目录下的 WebVTT 字幕文件
+	Results bool `yaml:"results"`
+}
+
+// SupportedCodecs 解码器支持的视频编码
+var SupportedCodecs = []string{"VP8", "VP9", "H264", "H265"}
+
+// SupportedBalancers 推理服务的负载均衡策略
+var SupportedBalancers = []string{"round_robin", "least_outstanding"}
+
+// SupportedRecognitionModes 识别结果的下发方式
+var SupportedRecognitionModes = []string{"debounce", "sentence"}
+
+// SupportedDatasetFormats 训练数据导出支持的帧格式
+var SupportedDatasetFormats = []string{"png", "jpeg", "npz"}
+
+// SupportedPixelFormats 解码器支持的输出像素格式
+var SupportedPixelFormats = []string{"rgba", "rgb24"}
+
+// Default 返回默认配置
+func Default() *Config {
+	return &Config{
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Signaling: SignalingConfig{
+			Addr: ":8081",
+			Path: "/ws/signaling",
+			TLS: TLSConfig{
+				ReloadInterval: time.Minute,
+				ClientAuth:     "none",
+			},
+			DataChannel:     "results",
+			ResumeGrace:     30 * time.Second,
+			PingInterval:    20 * time.Second,
+			PongWait:        60 * time.Second,
+			WriteWait:       10 * time.Second,
+			MaxMessageSize:  64 << 10,
+			IdleTimeout:     2 * time.Minute,
+			ShutdownDelay:   5 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		ICE: ICEConfig{
+			Servers: []ICEServer{
+				{URLs: []string{"stun:stun.l.google.com:19302"}},
+			},
+			RestartDelay:   3 * time.Second,
+			FailureTimeout: 30 * time.Second,
+		},
+		Codecs: []string{"VP8", "VP9", "H264"},
+		Decoder: DecoderConfig{
+			PixelFormat: "rgba",
+		},
+		Inference: InferenceConfig{
+			Address:         "localhost:50051",
+			Balancer:        "round_robin",
+			Sticky:          true,
+			MaxAttempts:     2,
+			ResolveInterval: 30 * time.Second,
+			Ejection: EjectionConfig{
+				ConsecutiveFailures: 3,
+				Duration:            30 * time.Second,
+			},
+			Timeout: 3 * time.Second,
+			TLS: InferenceTLSConfig{
+				ReloadInterval: time.Minute,
+			},
+		},
+		Recognition: RecognitionConfig{
+			DebouncePeriod: 2 * time.Second,
+			EmptyResult:    "result is None",
+			Mode:           "debounce",
+			Aggregator: AggregatorConfig{
+				Window:        time.Second,
+				VoteThreshold: 0.5,
+				MinFrames:     3,
+				MinConfidence: 0.3,
+				SignGap:       500 * time.Millisecond,
+				SentenceGap:   2 * time.Second,
+				MaxWords:      20,
+				Separator:     " ",
+			},
+		},
+		Sinks: SinksConfig{
+			Default: []string{"inference"},
+			Allowed: []string{"inference"},
+			Thumbnail: ThumbnailConfig{
+				Dir:      "thumbnails",
+				Interval: 5 * time.Second,
+				Width:    320,
+			},
+			Dataset: DatasetConfig{
+				Dir:                 "dataset",
+				Format:              "png",
+				Interval:            500 * time.Millisecond,
+				MaxFramesPerSession: 1000,
+				Retention: RetentionConfig{
+					MaxAge: 30 * 24 * time.Hour,
+				},
+			},
+		},
+		Recording: RecordingConfig{
+			Dir:             "recordings",
+			MaxFileSize:     512 << 20,
+			MaxFileDuration: 10 * time.Minute,
+			Audio:           true,
+			Results:         true,
+		},
+		Capacity: CapacityConfig{
+			Enabled:      true,
+			UnitsPerCore: 4,
+			DowngradeAt:  0.8,
+			CodecCost:    map[string]float64{"VP8": 1, "VP9": 1.5, "H264": 1, "H265": 2},
+			Default:      StreamSpec{Width: 640, Height: 480, FPS: 30},
+			Downgrade:    StreamSpec{Width: 320, Height: 240, FPS: 3, Bitrate: 300_000},
+		},
+		Bitrate: BitrateConfig{
+			Enabled:       true,
+			Default:       800_000,
+			LoadThreshold: 0.8,
+			Min:           150_000,
+			Interval:      time.Second,
+		},
+		Cluster: ClusterConfig{
+			Directory: "memory",
+			Redis: RedisConfig{
+				Address:   "localhost:6379",
+				KeyPrefix: "webrtc-server:",
+				Timeout:   time.Second,
+			},
+			Forward: "proxy",
+			TTL:     time.Minute,
+		},
+		Limits: LimitsConfig{
+			MaxSessions: 200,
+			PerIP: QuotaConfig{
+				MaxSessions:       10,
+				SessionsPerMinute: 30,
+				MessageRate:       20,
+				MessageBurst:      100,
+			},
+			PerIdentity: QuotaConfig{
+				MaxSessions:       50,
+				SessionsPerMinute: 120,
+				MessageRate:       100,
+				MessageBurst:      500,
+			},
+		},
+	}
+}
+
+// Load 在默认配置基础上读取配置文件，path 为空时只返回默认配置
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ApplyEnv 使用环境变量覆盖配置，保留原有的 SIGNALING_PORT 与 GRPC_SERVER_ADDRESS
+func (c *Config) ApplyEnv() {
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		c.Log.Level = v
+	}
+	if v := os.Getenv("LOG_FORMAT"); v != "" {
+		c.Log.Format = v
+	}
+	if v := os.Getenv("SIGNALING_PORT"); v != "" {
+		c.Signaling.Addr = ":" + v
+	}
+	if v := os.Getenv("SIGNALING_ADDR"); v != "" {
+		c.Signaling.Addr = v
+	}
+	if v := os.Getenv("GRPC_SERVER_ADDRESS"); v != "" {
+		c.Inference.SetAddress(v)
+	}
+	if v := os.Getenv("GRPC_AUTH_TOKEN"); v != "" {
+		c.Inference.AuthToken = v
+	}
+	// Kubernetes 中通常由 Downward API 注入 Pod 名称与 IP
+	if v := os.Getenv("CLUSTER_NODE_ID"); v != "" {
+		c.Cluster.NodeID = v
+	}
+	if v := os.Getenv("CLUSTER_ADVERTISE_URL"); v != "" {
+		c.Cluster.AdvertiseURL = v
+	}
+	if v := os.Getenv("REDIS_PASSWORD"); v != "" {
+		c.Cluster.Redis.Password = v
+	}
+	if v := os.Getenv("ADMIN_TOKEN"); v != "" {
+		c.Signaling.Admin.Token = v
+	}
+}
+
+// Validate 校验配置，返回所有发现的问题
+func (c *Config) Validate() error {
+	var errs []error
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %w", err))
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("log.format %q must be text or json", c.Log.Format))
+	}
+	if c.Signaling.Addr == "" {
+		errs = append(errs, errors.New("signaling.addr must not be empty"))
+	}
+	if !strings.HasPrefix(c.Signaling.Path, "/") {
+		errs = append(errs, fmt.Errorf("signaling.path %q must start with /", c.Signaling.Path))
+	}
+	if (c.Signaling.TLS.CertFile == "") != (c.Signaling.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("signaling.tls.cert_file and signaling.tls.key_file must be set together"))
+	}
+	if clientAuth, err := tlsutil.ParseClientAuth(c.Signaling.TLS.ClientAuth); err != nil {
+		errs = append(errs, fmt.Errorf("signaling.tls.client_auth: %w", err))
+	} else if clientAuth >= tls.VerifyClientCertIfGiven && c.Signaling.TLS.ClientCAFile == "" {
+		errs = append(errs, errors.New("signaling.tls.client_ca_file is required to verify client certificates"))
+	}
+	if c.Signaling.TLS.RedirectAddr != "" && !c.Signaling.TLS.Enabled() {
+		errs = append(errs, errors.New("signaling.tls.redirect_addr requires TLS to be enabled"))
+	}
+	if len(c.Signaling.Admin.ClientCerts) > 0 && (c.Signaling.TLS.ClientCAFile == "" || c.Signaling.TLS.ClientAuth == "none") {
+		errs = append(errs, errors.New("signaling.admin.client_certs requires client certificate verification in signaling.tls"))
+	}
+	if c.Signaling.TLS.ReloadInterval < 0 {
+		errs = append(errs, errors.New("signaling.tls.reload_interval must not be negative"))
+	}
+	for i, server := range c.ICE.Servers {
+		if len(server.URLs) == 0 {
+			errs = append(errs, fmt.Errorf("ice.servers[%d].urls must not be empty", i))
+		}
+	}
+	if len(c.Codecs) == 0 {
+		errs = append(errs, errors.New("codecs must not be empty"))
+	}
+	for _, codec := range c.Codecs {
+		if !slices.Contains(SupportedCodecs, codec) {
+			errs = append(errs, fmt.Errorf("codec %q not supported, expected one of %v", codec, SupportedCodecs))
+		}
+	}
+	if !slices.Contains(SupportedPixelFormats, c.Decoder.PixelFormat) {
+		errs = append(errs, fmt.Errorf("decoder.pixel_format %q not supported, expected one of %v", c.Decoder.PixelFormat, SupportedPixelFormats))
+	}
+	if c.ICE.RestartDelay <= 0 || c.ICE.FailureTimeout <= c.ICE.RestartDelay {
+		errs = append(errs, errors.New("ice.restart_delay must be positive and shorter than ice.failure_timeout"))
+	}
+	if c.Signaling.ResumeGrace < 0 {
+		errs = append(errs, errors.New("signaling.resume_grace must not be negative"))
+	}
+	if c.Signaling.PingInterval <= 0 || c.Signaling.PongWait <= c.Signaling.PingInterval {
+		errs = append(errs, errors.New("signaling.ping_interval must be positive and shorter than signaling.pong_wait"))
+	}
+	if c.Signaling.WriteWait <= 0 {
+		errs = append(errs, errors.New("signaling.write_wait must be positive"))
+	}
+	if c.Signaling.MaxMessageSize <= 0 {
+		errs = append(errs, errors.New("signaling.max_message_size must be positive"))
+	}
+	if c.Signaling.IdleTimeout < 0 {
+		errs = append(errs, errors.New("signaling.idle_timeout must not be negative"))
+	}
+	if c.Signaling.ShutdownDelay < 0 || c.Signaling.ShutdownTimeout < 0 {
+		errs = append(errs, errors.New("signaling.shutdown_delay and signaling.shutdown_timeout must not be negative"))
+	}
+	if c.Capacity.Enabled {
+		capacity := c.Capacity
+		if capacity.Budget < 0 || capacity.UnitsPerCore < 0 || (capacity.Budget == 0 && capacity.UnitsPerCore == 0) {
+			errs = append(errs, errors.New("capacity.budget or capacity.units_per_core must be positive"))
+		}
+		if capacity.DowngradeAt <= 0 || capacity.DowngradeAt > 1 {
+			errs = append(errs, fmt.Errorf("capacity.downgrade_at %v must be in (0, 1]", capacity.DowngradeAt))
+		}
+		for _, codec := range SupportedCodecs {
+			if cost, ok := capacity.CodecCost[codec]; ok && cost <= 0 {
+				errs = append(errs, fmt.Errorf("capacity.codec_cost[%s] must be positive", codec))
+			}
+		}
+		if spec := capacity.Default; spec.Width <= 0 || spec.Height <= 0 || spec.FPS <= 0 {
+			errs = append(errs, errors.New("capacity.default width, height and fps must be positive"))
+		}
+		if spec := capacity.Downgrade; spec.Width <= 0 || spec.Height <= 0 || spec.FPS <= 0 || spec.Bitrate <= 0 {
+			errs = append(errs, errors.New("capacity.downgrade width, height, fps and bitrate must be positive"))
+		}
+	}
+	if c.Bitrate.Enabled {
+		bitrate := c.Bitrate
+		if bitrate.Default <= 0 || bitrate.Min <= 0 || bitrate.Min > bitrate.Default {
+			errs = append(errs, errors.New("bitrate.default and bitrate.min must be positive and min must not exceed default"))
+		}
+		for model, rate := range bitrate.Models {
+			if rate < bitrate.Min {
+				errs = append(errs, fmt.Errorf("bitrate.models[%q] must be at least bitrate.min", model))
+			}
+		}
+		if bitrate.LoadThreshold <= 0 || bitrate.LoadThreshold > 1 {
+			errs = append(errs, fmt.Errorf("bitrate.load_threshold %v must be in (0, 1]", bitrate.LoadThreshold))
+		}
+		if bitrate.Interval <= 0 {
+			errs = append(errs, errors.New("bitrate.interval must be positive"))
+		}
+	}
+	if c.Cluster.Enabled {
+		cluster := c.Cluster
+		if u, err := url.Parse(cluster.AdvertiseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("cluster.advertise_url %q must be an http or https URL", cluster.AdvertiseURL))
+		}
+		if !slices.Contains(SupportedDirectories, cluster.Directory) {
+			errs = append(errs, fmt.Errorf("cluster.directory %q not supported, expected one of %v", cluster.Directory, SupportedDirectories))
+		}
+		if cluster.Directory == "redis" && (cluster.Redis.Address == "" || cluster.Redis.Timeout <= 0) {
+			errs = append(errs, errors.New("cluster.redis.address and cluster.redis.timeout are required"))
+		}
+		if cluster.Forward != "proxy" && cluster.Forward != "redirect" {
+			errs = append(errs, fmt.Errorf("cluster.forward %q must be proxy or redirect", cluster.Forward))
+		}
+		if cluster.TTL <= 0 {
+			errs = append(errs, errors.New("cluster.ttl must be positive"))
+		}
+	}
+	if c.Limits.MaxSessions < 0 {
+		errs = append(errs, errors.New("limits.max_sessions must not be negative"))
+	}
+	if err := c.Limits.PerIP.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("limits.per_ip: %w", err))
+	}
+	if err := c.Limits.PerIdentity.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("limits.per_identity: %w", err))
+	}
+	tokens := make(map[string]bool)
+	for i, t := range c.Limits.Tokens {
+		if t.Name == "" || t.Token == "" {
+			errs = append(errs, fmt.Errorf("limits.tokens[%d] must have a name and a token", i))
+		} else if tokens[t.Token] {
+			errs = append(errs, fmt.Errorf("limits.tokens[%d] duplicates an earlier token", i))
+		}
+		tokens[t.Token] = true
+	}
+	for _, target := range c.Inference.Targets() {
+		if target == "" {
+			errs = append(errs, errors.New("inference.address and inference.endpoints must not be empty"))
+		}
+	}
+	for model, targets := range c.Inference.Models {
+		if model == "" || len(targets) == 0 || slices.Contains(targets, "") {
+			errs = append(errs, fmt.Errorf("inference.models[%q] must have a name and non-empty endpoints", model))
+		}
+	}
+	if !slices.Contains(SupportedBalancers, c.Inference.Balancer) {
+		errs = append(errs, fmt.Errorf("inference.balancer %q not supported, expected one of %v", c.Inference.Balancer, SupportedBalancers))
+	}
+	if c.Inference.MaxAttempts < 1 {
+		errs = append(errs, errors.New("inference.max_attempts must be at least 1"))
+	}
+	if c.Inference.ResolveInterval <= 0 {
+		errs = append(errs, errors.New("inference.resolve_interval must be positive"))
+	}
+	if c.Inference.Ejection.ConsecutiveFailures < 0 || c.Inference.Ejection.Duration < 0 {
+		errs = append(errs, errors.New("inference.ejection values must not be negative"))
+	}
+	if c.Inference.Timeout <= 0 {
+		errs = append(errs, errors.New("inference.timeout must be positive"))
+	}
+	inferenceTLS := c.Inference.TLS
+	if (inferenceTLS.CertFile == "") != (inferenceTLS.KeyFile == "") {
+		errs = append(errs, errors.New("inference.tls.cert_file and inference.tls.key_file must be set together"))
+	}
+	if !inferenceTLS.Enabled && (inferenceTLS.CAFile != "" || inferenceTLS.CertFile != "" || inferenceTLS.ServerName != "") {
+		errs = append(errs, errors.New("inference.tls settings require inference.tls.enabled"))
+	}
+	if (c.Inference.AuthToken != "" || c.Inference.AuthTokenFile != "") && !inferenceTLS.Enabled {
+		errs = append(errs, errors.New("inference auth token must not be sent without inference.tls.enabled"))
+	}
+	if c.Recognition.DebouncePeriod < 0 {
+		errs = append(errs, errors.New("recognition.debounce_period must not be negative"))
+	}
+	for i, f := range c.Recognition.Filters {
+		if err := f.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("recognition.filters[%d]: %w", i, err))
+		}
+	}
+	if !slices.Contains(SupportedRecognitionModes, c.Recognition.Mode) {
+		errs = append(errs, fmt.Errorf("recognition.mode %q not supported, expected one of %v", c.Recognition.Mode, SupportedRecognitionModes))
+	}
+	if c.Recognition.Mode == "sentence" {
+		// 聚合器按置信度投票确认手语词，逐帧过滤器会打乱投票
+		if len(c.Recognition.Filters) > 0 {
+			errs = append(errs, errors.New("recognition.filters is not supported in sentence mode"))
+		}
+		agg := c.Recognition.Aggregator
+		if agg.Window <= 0 || agg.SignGap <= 0 {
+			errs = append(errs, errors.New("recognition.aggregator.window and sign_gap must be positive"))
+		}
+		if agg.SentenceGap < agg.SignGap {
+			errs = append(errs, errors.New("recognition.aggregator.sentence_gap must not be shorter than sign_gap"))
+		}
+		if agg.VoteThreshold <= 0 || agg.VoteThreshold > 1 || agg.MinConfidence < 0 || agg.MinConfidence > 1 {
+			errs = append(errs, errors.New("recognition.aggregator.vote_threshold and min_confidence must be within (0, 1]"))
+		}
+		if agg.MinFrames < 1 || agg.MaxWords < 0 {
+			errs = append(errs, errors.New("recognition.aggregator.min_frames must be at least 1 and max_words must not be negative"))
+		}
+	}
+	for _, name := range c.Sinks.Default {
+		if !slices.Contains(c.Sinks.Allowed, name) {
+			errs = append(errs, fmt.Errorf("sinks.default: sink %q is not in sinks.allowed", name))
+		}
+	}
+	if slices.Contains(c.Sinks.Allowed, "thumbnail") && (c.Sinks.Thumbnail.Dir == "" || c.Sinks.Thumbnail.Interval <= 0) {
+		errs = append(errs, errors.New("sinks.thumbnail.dir and sinks.thumbnail.interval are required"))
+	}
+	if slices.Contains(c.Sinks.Allowed, "dataset") {
+		dataset := c.Sinks.Dataset
+		if dataset.Dir == "" || dataset.Interval <= 0 {
+			errs = append(errs, errors.New("sinks.dataset.dir and sinks.dataset.interval are required"))
+		}
+		if !slices.Contains(SupportedDatasetFormats, dataset.Format) {
+			errs = append(errs, fmt.Errorf("sinks.dataset.format %q not supported, expected one of %v", dataset.Format, SupportedDatasetFormats))
+		}
+		if dataset.MaxFramesPerSession < 0 || dataset.Retention.MaxAge < 0 || dataset.Retention.MaxTotalSize < 0 {
+			errs = append(errs, errors.New("sinks.dataset limits must not be negative"))
+		}
+	}
+	if c.Recording.Enabled && c.Recording.Dir == "" {
+		errs = append(errs, errors.New("recording.dir is required when recording is enabled"))
+	}
+	if c.Recording.MaxFileSize < 0 || c.Recording.MaxFileDuration < 0 {
+		errs = append(errs, errors.New("recording.max_file_size and recording.max_file_duration must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// YAML 将配置序列化为 YAML，用于 --print-config，凭据会被隐藏
+func (c *Config) YAML() ([]byte, error) {
+	redacted := *c
+	redacted.ICE.Servers = make([]ICEServer, len(c.ICE.Servers))
+	for i, server := range c.ICE.Servers {
+		if server.Credential != "" {
+			server.Credential = redactedValue
+		}
+		redacted.ICE.Servers[i] = server
+	}
+	if redacted.Inference.AuthToken != "" {
+		redacted.Inference.AuthToken = redactedValue
+	}
+	if redacted.Cluster.Redis.Password != "" {
+		redacted.Cluster.Redis.Password = redactedValue
+	}
+	if redacted.Signaling.Admin.Token != "" {
+		redacted.Signaling.Admin.Token = redactedValue
+	}
+	redacted.Limits.Tokens = make([]IdentityToken, len(c.Limits.Tokens))
+	for i, t := range c.Limits.Tokens {
+		t.Token = redactedValue
+		redacted.Limits.Tokens[i] = t
+	}
+	return yaml.Marshal(&redacted)
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("default config invalid: %v", err)
+	}
+}
+
+func TestLoadOverridesDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `
+signaling:
+  addr: ":9000"
+codecs: [H264]
+inference:
+  address: "inference:50051"
+  timeout: 500ms
+recognition:
+  debounce_period: 1s
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Signaling.Addr != ":9000" || cfg.Signaling.Path != "/ws/signaling" {
+		t.Fatalf("unexpected signaling config: %+v", cfg.Signaling)
+	}
+	if len(cfg.Codecs) != 1 || cfg.Codecs[0] != "H264" {
+		t.Fatalf("unexpected codecs: %v", cfg.Codecs)
+	}
+	if cfg.Inference.Timeout != 500*time.Millisecond || cfg.Recognition.DebouncePeriod != time.Second {
+		t.Fatalf("durations not parsed: %+v %+v", cfg.Inference, cfg.Recognition)
+	}
+}
+
+func TestLoadRejectsUnknownFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("signalling:\n  addr: \":9000\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("SIGNALING_PORT", "9090")
+	t.Setenv("GRPC_SERVER_ADDRESS", "inference:50051")
+
+	cfg := Default()
+	cfg.Inference.Endpoints = []string{"from-file:50051"}
+	cfg.ApplyEnv()
+	if cfg.Signaling.Addr != ":9090" {
+		t.Fatalf("SIGNALING_PORT not applied: %s", cfg.Signaling.Addr)
+	}
+	if targets := cfg.Inference.Targets(); len(targets) != 1 || targets[0] != "inference:50051" {
+		t.Fatalf("GRPC_SERVER_ADDRESS not applied: %v", targets)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Codecs = []string{"AV1"}
+	cfg.Decoder.PixelFormat = "yuv420p"
+	cfg.Signaling.TLS.CertFile = "cert.pem"
+	cfg.Recognition.Filters = []FilterConfig{{Type: "dedup", Period: time.Second}, {Type: "hysteresis", Enter: 0.3, Exit: 0.6}}
+	cfg.Recognition.Mode = "sentence"
+	cfg.Signaling.PingInterval = 2 * cfg.Signaling.PongWait
+	cfg.Limits.PerIP.MessageBurst = 0
+	cfg.Limits.Tokens = []IdentityToken{{Name: "web", Token: "t"}, {Name: "app", Token: "t"}}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"AV1", "yuv420p", "key_file", "recognition.filters[1]", "ping_interval", "limits.per_ip", "limits.tokens[1]", "sentence mode"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestYAMLRedactsCredentials(t *testing.T) {
+	cfg := Default()
+	cfg.ICE.Servers = append(cfg.ICE.Servers, ICEServer{URLs: []string{"turn:turn.example.com"}, Username: "user", Credential: "secret"})
+	cfg.Signaling.Admin.Token = "secret-admin-token"
+	cfg.Limits.Tokens = []IdentityToken{{Name: "web", Token: "secret-client-token"}}
+
+	out, err := cfg.YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "secret") {
+		t.Fatalf("credential leaked:\n%s", out)
+	}
+	if cfg.ICE.Servers[1].Credential != "secret" {
+		t.Fatal("YAML modified the original config")
+	}
+}
@@ -0,0 +1,166 @@
+package dataset
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readManifest(t *testing.T, path string) map[uint64]Entry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries := make(map[uint64]Entry)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries[e.Sequence] = e
+	}
+	return entries
+}
+
+func testSample(seq uint64) Sample {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	return Sample{Sequence: seq, ReceivedAt: time.Now(), Width: 4, Height: 2, Image: img, Pix: img.Pix, Channels: 4}
+}
+
+func TestWriterPairsResults(t *testing.T) {
+	cfg := config.DatasetConfig{Dir: t.TempDir(), Format: "png", MaxFramesPerSession: 3}
+	w, err := NewWriter(cfg, "s1", "t1", []string{"dataset"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 结果可能先于或晚于帧到达
+	w.SetResult(1, "你好")
+	w.Add(testSample(1))
+	w.Add(testSample(2))
+	w.SetResult(2, "谢谢")
+	w.SetResult(3, "未采样")
+	w.Add(testSample(4))
+	w.Add(testSample(5))
+	w.Add(testSample(6)) // 超出上限
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(cfg.Dir, "s1", "t1")
+	entries := readManifest(t, filepath.Join(dir, "manifest.jsonl"))
+	if len(entries) != 3 {
+		t.Fatalf("manifest has %d entries, want 3: %v", len(entries), entries)
+	}
+	if r := entries[1].Result; r == nil || *r != "你好" {
+		t.Errorf("frame 1 result = %v", r)
+	}
+	if r := entries[2].Result; r == nil || *r != "谢谢" {
+		t.Errorf("frame 2 result = %v", r)
+	}
+	if entries[4].Result != nil {
+		t.Errorf("frame 4 result = %q, want null", *entries[4].Result)
+	}
+	f, err := os.Open(filepath.Join(dir, entries[1].File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if img, err := png.Decode(f); err != nil || img.Bounds().Dx() != 4 {
+		t.Errorf("decoding exported frame: %v", err)
+	}
+}
+
+func TestWriterDropsResultsWhenFull(t *testing.T) {
+	cfg := config.DatasetConfig{Dir: t.TempDir(), Format: "png", MaxFramesPerSession: 2}
+	w, err := NewWriter(cfg, "s1", "t1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Add(testSample(1))
+	w.SetResult(2, "早到")
+	w.SetResult(3, "早到")
+	w.Add(testSample(2))
+	// 达到上限后每帧仍会产生结果，不应再缓存
+	for seq := uint64(3); seq < 1000; seq++ {
+		w.Add(testSample(seq))
+		w.SetResult(seq, "未采样")
+	}
+	w.SetResult(1, "你好")
+	if len(w.early) != 0 || len(w.pending) != 0 {
+		t.Fatalf("early %d, pending %d after reaching max frames", len(w.early), len(w.pending))
+	}
+}
+
+func TestWriterNPZ(t *testing.T) {
+	cfg := config.DatasetConfig{Dir: t.TempDir(), Format: "npz"}
+	w, err := NewWriter(cfg, "s1", "t1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Add(testSample(7))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader(filepath.Join(cfg.Dir, "s1", "t1", "frames.npz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if len(r.File) != 1 || r.File[0].Name != "00000007.npy" {
+		t.Fatalf("unexpected npz members: %v", r.File)
+	}
+	rc, _ := r.File[0].Open()
+	data, _ := io.ReadAll(rc)
+	headerLen := int(data[8]) | int(data[9])<<8
+	if !bytes.HasPrefix(data, []byte("\x93NUMPY\x01\x00")) || (10+headerLen)%64 != 0 {
+		t.Fatalf("invalid npy header: %q", data[:min(len(data), 80)])
+	}
+	if !bytes.Contains(data[:10+headerLen], []byte("'shape': (2, 4, 4)")) || len(data) != 10+headerLen+32 {
+		t.Errorf("unexpected npy content: %q", data[10:10+headerLen])
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, age := range []time.Duration{48 * time.Hour, 2 * time.Hour, time.Hour, 0} {
+		session := filepath.Join(dir, string(rune('a'+i)))
+		os.MkdirAll(session, 0o755)
+		file := filepath.Join(session, "manifest.jsonl")
+		os.WriteFile(file, make([]byte, 100), 0o644)
+		os.Chtimes(file, now.Add(-age), now.Add(-age))
+		os.Chtimes(session, now.Add(-age), now.Add(-age))
+	}
+
+	removed, err := Prune(dir, config.RetentionConfig{MaxAge: 24 * time.Hour, MaxTotalSize: 250}, now, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+	if len(removed) != 2 || removed[0] != want[0] || removed[1] != want[1] {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+
+	// 仍在导出的会话即使过期或超出总大小也保留，其大小仍计入总量
+	removed, err = Prune(dir, config.RetentionConfig{MaxAge: time.Minute, MaxTotalSize: 50}, now, map[string]bool{"c": true, "d": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("removed live sessions %v", removed)
+	}
+}
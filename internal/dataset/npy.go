@@ -0,0 +1,32 @@
+package dataset
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writeNPY 以 NumPy .npy 1.0 格式写入形状为 (height, width, channels) 的 uint8 数组
+func writeNPY(w io.Writer, pix []byte, height, width, channels int) error {
+	if len(pix) < height*width*channels {
+		return fmt.Errorf("pixel data too short: %d bytes for %dx%dx%d", len(pix), height, width, channels)
+	}
+	header := fmt.Sprintf("{'descr': '|u1', 'fortran_order': False, 'shape': (%d, %d, %d), }", height, width, channels)
+	// 魔数、版本与长度共 10 字节，头部整体按 64 字节对齐并以换行结尾
+	padding := 64 - (10+len(header)+1)%64
+	header += strings.Repeat(" ", padding%64) + "\n"
+
+	prefix := make([]byte, 10)
+	copy(prefix, "\x93NUMPY")
+	prefix[6], prefix[7] = 1, 0
+	binary.LittleEndian.PutUint16(prefix[8:], uint16(len(header)))
+	if _, err := w.Write(prefix); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	_, err := w.Write(pix[:height*width*channels])
+	return err
+}
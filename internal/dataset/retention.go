@@ -0,0 +1,82 @@
+package dataset
+
+import (
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/fileutil"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+type sessionDir struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// Prune 按保留策略删除 dir 下过期或超出总大小的会话目录，返回删除的目录。
+// active 中的会话仍在写入，其目录不会被删除，但大小计入总量
+func Prune(dir string, retention config.RetentionConfig, now time.Time, active map[string]bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	live := make(map[string]bool, len(active))
+	for id := range active {
+		live[fileutil.SanitizeName(id)] = true
+	}
+	var sessions []sessionDir
+	var total int64
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		s := sessionDir{path: filepath.Join(dir, e.Name())}
+		// 目录的修改时间不随深层文件更新，取其中最新文件的时间
+		err := filepath.WalkDir(s.path, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if info.ModTime().After(s.modTime) {
+				s.modTime = info.ModTime()
+			}
+			if !d.IsDir() {
+				s.size += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		total += s.size
+		if !live[e.Name()] {
+			sessions = append(sessions, s)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b sessionDir) int { return a.modTime.Compare(b.modTime) })
+
+	var removed []string
+	for _, s := range sessions {
+		expired := retention.MaxAge > 0 && now.Sub(s.modTime) > retention.MaxAge
+		oversize := retention.MaxTotalSize > 0 && total > retention.MaxTotalSize
+		if !expired && !oversize {
+			continue
+		}
+		if err := os.RemoveAll(s.path); err != nil {
+			return removed, err
+		}
+		total -= s.size
+		removed = append(removed, s.path)
+	}
+	return removed, nil
+}
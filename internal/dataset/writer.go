@@ -0,0 +1,248 @@
+// Package dataset 将采样的视频帧与识别结果导出为训练数据
+package dataset
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/fileutil"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sample 一帧待导出的数据，png/jpeg 使用 Image，npz 使用 Pix
+type Sample struct {
+	Sequence     uint64
+	RTPTimestamp uint32
+	ReceivedAt   time.Time
+	Width        int
+	Height       int
+	Image        image.Image
+	// Pix 按行存储的像素，每个像素 Channels 个字节
+	Pix      []byte
+	Channels int
+}
+
+// Entry manifest.jsonl 中的一行
+type Entry struct {
+	SessionID    string    `json:"session_id"`
+	TrackID      string    `json:"track_id"`
+	Sequence     uint64    `json:"sequence"`
+	RTPTimestamp uint32    `json:"rtp_timestamp"`
+	ReceivedAt   time.Time `json:"received_at"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	// File 相对 manifest 所在目录的路径，npz 格式时 Member 为其中的数组名
+	File   string `json:"file"`
+	Member string `json:"member,omitempty"`
+	// Result 模型对该帧的识别结果，没有结果时为 null
+	Result  *string  `json:"result"`
+	Consent []string `json:"consent"`
+}
+
+// Writer 导出一个轨道的数据到 <dir>/<session_id>/<track_id>/，Add 不会被并发调用，SetResult 可以并发调用
+type Writer struct {
+	format    string
+	maxFrames int
+	dir       string
+	sessionID string
+	trackID   string
+	consent   []string
+
+	npzFile *os.File
+	npz     *zip.Writer
+	frames  int
+
+	mu       sync.Mutex
+	manifest *os.File
+	buf      *bufio.Writer
+	pending  map[uint64]*Entry
+	// early 保存先于 Add 到达的结果，帧与结果由不同的 sink 并发处理
+	early  map[uint64]string
+	closed bool
+}
+
+func NewWriter(cfg config.DatasetConfig, sessionID, trackID string, consent []string) (*Writer, error) {
+	dir := filepath.Join(cfg.Dir, fileutil.SanitizeName(sessionID), fileutil.SanitizeName(trackID))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating dataset directory: %w", err)
+	}
+	manifest, err := os.Create(filepath.Join(dir, "manifest.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("creating manifest: %w", err)
+	}
+	w := &Writer{
+		format:    cfg.Format,
+		maxFrames: cfg.MaxFramesPerSession,
+		dir:       dir,
+		sessionID: sessionID,
+		trackID:   trackID,
+		consent:   consent,
+		manifest:  manifest,
+		buf:       bufio.NewWriter(manifest),
+		pending:   make(map[uint64]*Entry),
+		early:     make(map[uint64]string),
+	}
+	if cfg.Format == "npz" {
+		w.npzFile, err = os.Create(filepath.Join(dir, "frames.npz"))
+		if err != nil {
+			manifest.Close()
+			return nil, fmt.Errorf("creating npz: %w", err)
+		}
+		w.npz = zip.NewWriter(w.npzFile)
+	}
+	return w, nil
+}
+
+// Full 是否已达到导出帧数上限，frames 只由 Add 修改，SetResult 中需持有 mu
+func (w *Writer) Full() bool {
+	return w.maxFrames > 0 && w.frames >= w.maxFrames
+}
+
+// Add 保存一帧，结果到达后写入 manifest
+func (w *Writer) Add(s Sample) error {
+	if w.Full() {
+		w.mu.Lock()
+		clear(w.early)
+		w.mu.Unlock()
+		return nil
+	}
+	entry := &Entry{
+		SessionID:    w.sessionID,
+		TrackID:      w.trackID,
+		Sequence:     s.Sequence,
+		RTPTimestamp: s.RTPTimestamp,
+		ReceivedAt:   s.ReceivedAt,
+		Width:        s.Width,
+		Height:       s.Height,
+		Consent:      w.consent,
+	}
+	if err := w.writeFrame(s, entry); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.frames++
+	if result, ok := w.early[s.Sequence]; ok {
+		entry.Result = &result
+		err := w.writeEntry(entry)
+		w.dropEarly(s.Sequence)
+		return err
+	}
+	w.pending[s.Sequence] = entry
+	w.dropEarly(s.Sequence)
+	return nil
+}
+
+// dropEarly 丢弃不晚于 sequence 的未匹配结果，这些帧没有被采样；达到上限后丢弃全部
+func (w *Writer) dropEarly(sequence uint64) {
+	if w.Full() {
+		clear(w.early)
+		return
+	}
+	for seq := range w.early {
+		if seq <= sequence {
+			delete(w.early, seq)
+		}
+	}
+}
+
+func (w *Writer) writeFrame(s Sample, entry *Entry) error {
+	name := fmt.Sprintf("%08d", s.Sequence)
+	switch w.format {
+	case "npz":
+		member := name + ".npy"
+		f, err := w.npz.CreateHeader(&zip.FileHeader{Name: member, Method: zip.Store, Modified: s.ReceivedAt})
+		if err != nil {
+			return err
+		}
+		if err := writeNPY(f, s.Pix, s.Height, s.Width, s.Channels); err != nil {
+			return fmt.Errorf("writing %s: %w", member, err)
+		}
+		entry.File, entry.Member = "frames.npz", strings.TrimSuffix(member, ".npy")
+		return nil
+	case "jpeg":
+		entry.File = name + ".jpg"
+	default:
+		entry.File = name + ".png"
+	}
+
+	f, err := os.Create(filepath.Join(w.dir, entry.File))
+	if err != nil {
+		return err
+	}
+	if w.format == "jpeg" {
+		err = jpeg.Encode(f, s.Image, &jpeg.Options{Quality: 95})
+	} else {
+		err = png.Encode(f, s.Image)
+	}
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("encoding %s: %w", entry.File, err)
+	}
+	return f.Close()
+}
+
+// SetResult 记录模型对第 sequence 帧的识别结果
+func (w *Writer) SetResult(sequence uint64, result string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	entry, ok := w.pending[sequence]
+	if !ok {
+		// 达到上限后不会再采样，结果无需等待对应的帧
+		if !w.Full() {
+			w.early[sequence] = result
+		}
+		return nil
+	}
+	delete(w.pending, sequence)
+	entry.Result = &result
+	return w.writeEntry(entry)
+}
+
+func (w *Writer) writeEntry(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	w.buf.Write(data)
+	w.buf.WriteByte('\n')
+	return w.buf.Flush()
+}
+
+// Close 写出尚未得到结果的帧并关闭文件
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	var errs []error
+	for _, entry := range w.pending {
+		errs = append(errs, w.writeEntry(entry))
+	}
+	if w.npz != nil {
+		errs = append(errs, w.npz.Close(), w.npzFile.Close())
+	}
+	errs = append(errs, w.buf.Flush(), w.manifest.Close())
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
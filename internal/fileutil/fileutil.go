@@ -0,0 +1,15 @@
+// Package fileutil 提供录制、缩略图与数据集导出共用的文件名处理
+package fileutil
+
+import "strings"
+
+// SanitizeName 将会话 ID、轨道 ID 等不可信输入转换为安全的文件名，
+// 字母、数字、- 与 _ 以外的字符都替换为 _
+func SanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,16 @@
+package fileutil
+
+import "testing"
+
+func TestSanitizeName(t *testing.T) {
+	for in, want := range map[string]string{
+		"track-1_a":     "track-1_a",
+		"../../etc/pwd": "______etc_pwd",
+		"{id}":          "_id_",
+		"视频":            "__",
+	} {
+		if got := SanitizeName(in); got != want {
+			t.Errorf("SanitizeName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package grpc
+
+import (
+	"errors"
+	pb "github.com/haowei703/webrtc-server/github.com/haowei703/webrtc-server/proto"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"google.golang.org/grpc"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errNoBackend = errors.New("no inference backend available")
+
+// backend 一个推理服务实例
+type backend struct {
+	addr        string
+	conn        *grpc.ClientConn
+	client      pb.MessageExchangeClient
+	outstanding atomic.Int64
+
+	// 以下字段由 pool.mu 保护
+	failures     int
+	ejectedUntil time.Time
+}
+
+// pool 推理服务实例池，负责负载均衡、会话粘滞与被动摘除
+type pool struct {
+	mu       sync.Mutex
+	balancer string
+	sticky   bool
+	ejection config.EjectionConfig
+	backends []*backend
+	next     int
+	sessions map[string]*backend
+	now      func() time.Time
+	logger   *slog.Logger
+}
+
+func newPool(cfg config.InferenceConfig, logger *slog.Logger) *pool {
+	return &pool{
+		balancer: cfg.Balancer,
+		sticky:   cfg.Sticky,
+		ejection: cfg.Ejection,
+		sessions: make(map[string]*backend),
+		now:      time.Now,
+		logger:   logger,
+	}
+}
+
+// pick 为会话选择一个推理服务，exclude 中的实例本次不会被选中
+func (p *pool) pick(sessionID string, exclude map[*backend]bool) (*backend, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	var available []*backend
+	for _, b := range p.backends {
+		if !exclude[b] && !now.Before(b.ejectedUntil) {
+			available = append(available, b)
+		}
+	}
+
+	if p.sticky && sessionID != "" {
+		if b, ok := p.sessions[sessionID]; ok {
+			for _, a := range available {
+				if a == b {
+					return b, nil
+				}
+			}
+		}
+	}
+
+	// 全部实例都被摘除时，退而使用最早恢复的实例，避免整体不可用
+	if len(available) == 0 {
+		var fallback *backend
+		for _, b := range p.backends {
+			if !exclude[b] && (fallback == nil || b.ejectedUntil.Before(fallback.ejectedUntil)) {
+				fallback = b
+			}
+		}
+		if fallback == nil {
+			return nil, errNoBackend
+		}
+		available = []*backend{fallback}
+	}
+
+	var chosen *backend
+	switch p.balancer {
+	case "least_outstanding":
+		for i := range available {
+			b := available[(p.next+i)%len(available)]
+			if chosen == nil || b.outstanding.Load() < chosen.outstanding.Load() {
+				chosen = b
+			}
+		}
+	default:
+		chosen = available[p.next%len(available)]
+	}
+	p.next++
+
+	if p.sticky && sessionID != "" {
+		if previous, ok := p.sessions[sessionID]; ok && previous != chosen {
+			p.logger.Info("session moved to another inference backend", "session_id", sessionID, "from", previous.addr, "to", chosen.addr)
+		}
+		p.sessions[sessionID] = chosen
+	}
+	return chosen, nil
+}
+
+// report 记录一次调用结果，连续失败达到阈值的实例会被暂时摘除
+func (p *pool) report(b *backend, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if p.ejection.ConsecutiveFailures > 0 && b.failures >= p.ejection.ConsecutiveFailures {
+		b.failures = 0
+		b.ejectedUntil = p.now().Add(p.ejection.Duration)
+		p.logger.Warn("inference backend ejected", "backend", b.addr, "until", b.ejectedUntil)
+	}
+}
+
+// release 会话结束后解除粘滞绑定
+func (p *pool) release(sessionID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.sessions, sessionID)
+}
+
+// get 按地址查找实例
+func (p *pool) get(addr string) *backend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, b := range p.backends {
+		if b.addr == addr {
+			return b
+		}
+	}
+	return nil
+}
+
+// replace 替换实例列表，返回被移除的实例
+func (p *pool) replace(backends []*backend) []*backend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keep := make(map[*backend]bool, len(backends))
+	for _, b := range backends {
+		keep[b] = true
+	}
+	var removed []*backend
+	for _, b := range p.backends {
+		if !keep[b] {
+			removed = append(removed, b)
+		}
+	}
+	for id, b := range p.sessions {
+		if !keep[b] {
+			delete(p.sessions, id)
+		}
+	}
+	p.backends = backends
+	return removed
+}
+
+// all 返回当前全部实例
+func (p *pool) all() []*backend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*backend(nil), p.backends...)
+}
@@ -0,0 +1,149 @@
+package grpc
+
+import (
+	"context"
+	pb "github.com/haowei703/webrtc-server/github.com/haowei703/webrtc-server/proto"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// fakeExchange 返回固定结果或错误的推理服务
+type fakeExchange struct {
+	result string
+	err    error
+	calls  int
+}
+
+func (f *fakeExchange) SendMessage(context.Context, *pb.MessageRequest, ...grpc.CallOption) (*pb.MessageResponse, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &pb.MessageResponse{Result: f.result}, nil
+}
+
+func newTestPool(cfg config.InferenceConfig, addrs ...string) (*pool, []*backend) {
+	p := newPool(cfg, slog.Default())
+	var backends []*backend
+	for _, addr := range addrs {
+		backends = append(backends, &backend{addr: addr, client: &fakeExchange{result: addr}})
+	}
+	p.replace(backends)
+	return p, backends
+}
+
+func TestPoolRoundRobin(t *testing.T) {
+	cfg := config.Default().Inference
+	cfg.Sticky = false
+	p, _ := newTestPool(cfg, "a", "b", "c")
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		b, err := p.pick("", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, b.addr)
+	}
+	want := []string{"a", "b", "c", "a", "b", "c"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPoolLeastOutstanding(t *testing.T) {
+	cfg := config.Default().Inference
+	cfg.Sticky = false
+	cfg.Balancer = "least_outstanding"
+	p, backends := newTestPool(cfg, "a", "b", "c")
+	backends[0].outstanding.Store(2)
+	backends[1].outstanding.Store(0)
+	backends[2].outstanding.Store(1)
+
+	b, err := p.pick("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.addr != "b" {
+		t.Fatalf("expected least loaded backend b, got %s", b.addr)
+	}
+}
+
+func TestPoolStickyAndEjection(t *testing.T) {
+	cfg := config.Default().Inference
+	cfg.Ejection = config.EjectionConfig{ConsecutiveFailures: 2, Duration: time.Minute}
+	p, _ := newTestPool(cfg, "a", "b")
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	first, _ := p.pick("session", nil)
+	for i := 0; i < 3; i++ {
+		if b, _ := p.pick("session", nil); b != first {
+			t.Fatalf("session not sticky: %s != %s", b.addr, first.addr)
+		}
+	}
+
+	p.report(first, true)
+	if b, _ := p.pick("session", nil); b != first {
+		t.Fatal("backend ejected before reaching the failure threshold")
+	}
+	p.report(first, true)
+	moved, _ := p.pick("session", nil)
+	if moved == first {
+		t.Fatal("session not moved off the ejected backend")
+	}
+
+	// 摘除到期后新的会话可以再次使用该实例，已迁移的会话保持不变
+	now = now.Add(2 * time.Minute)
+	if b, _ := p.pick("session", nil); b != moved {
+		t.Fatal("migrated session should stay on its new backend")
+	}
+}
+
+func TestPoolFallbackWhenAllEjected(t *testing.T) {
+	cfg := config.Default().Inference
+	cfg.Ejection = config.EjectionConfig{ConsecutiveFailures: 1, Duration: time.Minute}
+	p, backends := newTestPool(cfg, "a", "b")
+	p.report(backends[0], true)
+	p.report(backends[1], true)
+
+	if _, err := p.pick("session", nil); err != nil {
+		t.Fatalf("expected fallback backend, got %v", err)
+	}
+	if _, err := p.pick("session", map[*backend]bool{backends[0]: true, backends[1]: true}); err != errNoBackend {
+		t.Fatalf("expected errNoBackend, got %v", err)
+	}
+}
+
+func TestClientFailover(t *testing.T) {
+	cfg := config.Default().Inference
+	p, backends := newTestPool(cfg, "a", "b")
+	backends[0].client = &fakeExchange{err: status.Error(codes.Unavailable, "down")}
+	c := &Client{routes: map[string]*route{"": {pool: p}}, timeout: time.Second, maxAttempts: 2, logger: slog.Default()}
+
+	result, err := c.SendMessage(context.Background(), Request{SessionID: "session"})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if result.Label != "b" {
+		t.Fatalf("expected result from backend b, got %q", result.Label)
+	}
+
+	// 业务错误与模型内部错误都不触发重试
+	for _, code := range []codes.Code{codes.InvalidArgument, codes.Internal} {
+		backends[1].client = &fakeExchange{err: status.Error(code, "bad frame")}
+		if _, err := c.SendMessage(context.Background(), Request{SessionID: "session"}); status.Code(err) != code {
+			t.Fatalf("expected %v, got %v", code, err)
+		}
+	}
+	if calls := backends[0].client.(*fakeExchange).calls; calls != 1 {
+		t.Fatalf("backend a called %d times, want 1", calls)
+	}
+}
@@ -2,40 +2,302 @@ package grpc
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	pb "github.com/haowei703/webrtc-server/github.com/haowei703/webrtc-server/proto"
+	"github.com/haowei703/webrtc-server/internal/config"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
-	"log"
-	"os"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
 	"time"
 )
 
-const (
-	defaultAddress = "localhost:50051" // The defaultAddress of the Python gRPC server
-)
+// Client 推理服务的 gRPC 客户端，可在多个会话间复用，支持多个推理服务间的负载均衡与故障转移，
+// 并按请求的模型路由到提供该模型的推理服务
+type Client struct {
+	// routes 以模型 ID 为键，"" 为默认的推理服务
+	routes      map[string]*route
+	dialOpts    []grpc.DialOption
+	timeout     time.Duration
+	maxAttempts int
+	logger      *slog.Logger
+	stop        context.CancelFunc
+}
+
+// route 提供同一模型的一组推理服务
+type route struct {
+	model     string
+	endpoints []endpoint
+	pool      *pool
+}
+
+// Request 一次推理请求
+type Request struct {
+	// SessionID 用于会话粘滞，为空时每帧独立选择推理服务
+	SessionID  string
+	TrackID    string
+	VideoFrame []byte
+	Width      int
+	Height     int
+	// PixelFormat VideoFrame 的像素格式：rgba 或 rgb24
+	PixelFormat string
+	// Sequence 轨道内的帧序号
+	Sequence     uint64
+	RTPTimestamp uint32
+	// CapturedAt 服务端收齐该帧的时间，作为采集时间的近似
+	CapturedAt time.Time
+	// Model 与 Language 为客户端选择的模型与手语种类，Model 为空时按 Language 路由
+	Model    string
+	Language string
+}
 
-func SendMessage(videoFrame []byte, width int, height int) (string, error) {
-	address := os.Getenv("GRPC_SERVER_ADDRESS")
-	if address == "" {
-		address = defaultAddress
+// NewClient 创建推理客户端，extra 会追加到每个实例的 DialOption 中，主要用于测试注入 bufconn
+func NewClient(cfg config.InferenceConfig, logger *slog.Logger, extra ...grpc.DialOption) (*Client, error) {
+	routes := make(map[string]*route)
+	targets := map[string][]string{"": cfg.Targets()}
+	for model, endpoints := range cfg.Models {
+		targets[model] = endpoints
 	}
-	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	dns := false
+	for model, t := range targets {
+		endpoints, err := parseEndpoints(t)
+		if err != nil {
+			return nil, err
+		}
+		dns = dns || hasDNS(endpoints)
+		routes[model] = &route{model: model, endpoints: endpoints, pool: newPool(cfg, logger)}
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	opts, err := dialOptions(ctx, cfg, logger)
 	if err != nil {
-		log.Fatalf("did not connect: %v", err)
+		stop()
+		return nil, err
 	}
-	defer func(conn *grpc.ClientConn) {
-		err := conn.Close()
+
+	c := &Client{
+		routes:      routes,
+		dialOpts:    append(opts, extra...),
+		timeout:     cfg.Timeout,
+		maxAttempts: cfg.MaxAttempts,
+		logger:      logger,
+		stop:        stop,
+	}
+	if err := c.refresh(ctx); err != nil {
+		stop()
+		c.closeAll()
+		return nil, err
+	}
+	if dns {
+		go c.watch(ctx, cfg.ResolveInterval)
+	}
+	logger.Debug("gRPC client created", "targets", cfg.Targets(), "models", len(cfg.Models), "balancer", cfg.Balancer, "tls", cfg.TLS.Enabled)
+	return c, nil
+}
+
+// SendMessage 将视频帧发送给推理服务并返回识别结果，推理服务不可用时切换到其他实例重试
+func (c *Client) SendMessage(ctx context.Context, req Request) (Result, error) {
+	r := c.route(req)
+	tried := make(map[*backend]bool)
+	var lastErr error
+	for attempt := 0; attempt < c.maxAttempts; attempt++ {
+		b, err := r.pool.pick(req.SessionID, tried)
 		if err != nil {
-			panic(err)
+			if lastErr != nil {
+				return Result{}, lastErr
+			}
+			return Result{}, err
 		}
-	}(conn)
-	c := pb.NewMessageExchangeClient(conn)
+		tried[b] = true
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		result, err := c.send(ctx, b, req)
+		failed := isBackendFailure(err)
+		r.pool.report(b, failed)
+		if err == nil {
+			return result, nil
+		}
+		lastErr = err
+		if !failed || ctx.Err() != nil {
+			break
+		}
+		c.logger.Warn("inference backend failed", "backend", b.addr, "attempt", attempt+1, "error", err)
+	}
+	return Result{}, lastErr
+}
+
+// route 返回提供请求模型的推理服务，没有单独配置的模型使用默认推理服务
+func (c *Client) route(req Request) *route {
+	key := req.Model
+	if key == "" {
+		key = req.Language
+	}
+	if r, ok := c.routes[key]; ok {
+		return r
+	}
+	return c.routes[""]
+}
+
+func (c *Client) send(ctx context.Context, b *backend, req Request) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
-	r, err := c.SendMessage(ctx, &pb.MessageRequest{VideoFrame: videoFrame, Width: int32(width), Height: int32(height)})
+
+	b.outstanding.Add(1)
+	defer b.outstanding.Add(-1)
+
+	start := time.Now()
+	r, err := b.client.SendMessage(ctx, newMessageRequest(req))
+	if err != nil {
+		return Result{}, err
+	}
+	c.logger.Debug("SendMessage done", "backend", b.addr, "model", req.Model, "width", req.Width, "height", req.Height, "elapsed", time.Since(start))
+	return newResult(r), nil
+}
+
+// ReleaseSession 会话结束时调用，解除会话与推理服务的绑定
+func (c *Client) ReleaseSession(sessionID string) {
+	for _, r := range c.routes {
+		r.pool.release(sessionID)
+	}
+}
+
+func (c *Client) Close() error {
+	c.stop()
+	c.closeAll()
+	return nil
+}
+
+func (c *Client) closeAll() {
+	for _, r := range c.routes {
+		c.closeBackends(r.pool.replace(nil))
+	}
+}
+
+// refresh 重新解析全部路由的地址，单个路由失败时保留其原有实例并继续刷新其他路由
+func (c *Client) refresh(ctx context.Context) error {
+	var errs []error
+	for _, r := range c.routes {
+		if err := c.refreshRoute(ctx, r); err != nil {
+			if r.model != "" {
+				err = fmt.Errorf("model %s: %w", r.model, err)
+			}
+			if ctx.Err() == nil {
+				c.logger.Warn("failed to refresh inference backends", "model", r.model, "error", err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// refreshRoute 重新解析地址并同步实例列表，已有实例的连接会被复用
+func (c *Client) refreshRoute(ctx context.Context, r *route) error {
+	addrs, err := resolve(ctx, r.endpoints)
 	if err != nil {
-		return "", err
+		return err
+	}
+	if len(addrs) == 0 {
+		return errNoBackend
+	}
+
+	backends := make([]*backend, 0, len(addrs))
+	var added []*backend
+	for _, a := range addrs {
+		if b := r.pool.get(a.addr); b != nil {
+			backends = append(backends, b)
+			continue
+		}
+		opts := c.dialOpts
+		if a.authority != "" {
+			opts = append(append([]grpc.DialOption(nil), opts...), grpc.WithAuthority(a.authority))
+		}
+		conn, err := grpc.NewClient(a.addr, opts...)
+		if err != nil {
+			c.closeBackends(added)
+			return fmt.Errorf("did not connect to %s: %w", a.addr, err)
+		}
+		b := &backend{addr: a.addr, conn: conn, client: pb.NewMessageExchangeClient(conn)}
+		added = append(added, b)
+		backends = append(backends, b)
+	}
+
+	removed := r.pool.replace(backends)
+	for _, b := range added {
+		c.logger.Info("inference backend added", "backend", b.addr, "model", r.model)
+	}
+	for _, b := range removed {
+		c.logger.Info("inference backend removed", "backend", b.addr, "model", r.model)
+	}
+	if len(removed) > 0 {
+		// 等待进行中的请求结束后再关闭连接
+		time.AfterFunc(c.timeout, func() { c.closeBackends(removed) })
+	}
+	return nil
+}
+
+// watch 定期重新解析 DNS 地址
+func (c *Client) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// 失败的路由已在 refresh 中逐个记录
+			_ = c.refresh(ctx)
+		}
+	}
+}
+
+func (c *Client) closeBackends(backends []*backend) {
+	for _, b := range backends {
+		if b.conn != nil {
+			_ = b.conn.Close()
+		}
+	}
+}
+
+// isBackendFailure 判断错误是否由推理服务本身不可用引起，业务错误不触发摘除与重试。
+// Internal 多为模型处理该帧时出错，换一个实例同样会失败
+func isBackendFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// SendMessage 使用一次性连接发送单帧，主要用于调试
+func SendMessage(videoFrame []byte, width int, height int) (Result, error) {
+	cfg := config.Default()
+	cfg.ApplyEnv()
+	c, err := NewClient(cfg.Inference, slog.Default())
+	if err != nil {
+		return Result{}, err
+	}
+	defer c.Close()
+	return c.SendMessage(context.Background(), Request{VideoFrame: videoFrame, Width: width, Height: height})
+}
+
+func newMessageRequest(req Request) *pb.MessageRequest {
+	m := &pb.MessageRequest{
+		VideoFrame:    req.VideoFrame,
+		Width:         int32(req.Width),
+		Height:        int32(req.Height),
+		SessionId:     req.SessionID,
+		TrackId:       req.TrackID,
+		FrameSequence: req.Sequence,
+		RtpTimestamp:  req.RTPTimestamp,
+		PixelFormat:   req.PixelFormat,
+		Model:         req.Model,
+		Language:      req.Language,
+	}
+	if !req.CapturedAt.IsZero() {
+		m.CaptureTimeMs = req.CapturedAt.UnixMilli()
 	}
-	return r.GetResult(), nil
+	return m
 }
@@ -0,0 +1,77 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/tlsutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// dialOptions 按配置创建传输层凭据与每次调用的认证信息，ctx 结束时停止证书热加载
+func dialOptions(ctx context.Context, cfg config.InferenceConfig, logger *slog.Logger) ([]grpc.DialOption, error) {
+	if !cfg.TLS.Enabled {
+		return []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: cfg.TLS.ServerName,
+	}
+	if cfg.TLS.CAFile != "" {
+		pool, err := tlsutil.LoadCertPool(cfg.TLS.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.TLS.CertFile != "" {
+		reloader, err := tlsutil.NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, logger)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		if cfg.TLS.ReloadInterval > 0 {
+			go reloader.Watch(ctx, cfg.TLS.ReloadInterval)
+		}
+		tlsConfig.GetClientCertificate = reloader.GetClientCertificate
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))}
+
+	token, err := loadAuthToken(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerToken(token)))
+	}
+	return opts, nil
+}
+
+// loadAuthToken 读取推理服务的认证 token，文件优先
+func loadAuthToken(cfg config.InferenceConfig) (string, error) {
+	if cfg.AuthTokenFile == "" {
+		return cfg.AuthToken, nil
+	}
+	data, err := os.ReadFile(cfg.AuthTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("reading auth token file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// bearerToken 以 Bearer 方式在每次调用的元数据中携带 token
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t bearerToken) RequireTransportSecurity() bool {
+	return true
+}
@@ -1,17 +1,193 @@
 package grpc
 
 import (
+	"context"
+	"errors"
+	pb "github.com/haowei703/webrtc-server/github.com/haowei703/webrtc-server/proto"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/grpc/grpctest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"log/slog"
+	"reflect"
 	"testing"
+	"time"
 )
 
+func newMockClient(t *testing.T, server *grpctest.Server, cfg config.InferenceConfig) *Client {
+	t.Helper()
+	cfg.Endpoints = []string{server.Target()}
+	c, err := NewClient(cfg, slog.Default(), server.DialOptions()...)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
 func TestSendMessage(t *testing.T) {
+	server := grpctest.NewServer()
+	defer server.Close()
+	server.Script(grpctest.Response{Result: "hello"})
+
+	c := newMockClient(t, server, config.Default().Inference)
 	var testData = []byte("test")
-	resp, err := SendMessage(testData, 1, 1)
+	resp, err := c.SendMessage(context.Background(), Request{SessionID: "session", VideoFrame: testData, Width: 1, Height: 1})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if resp.Label != "hello" || resp.Confidence != 1 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	requests := server.Requests()
+	if len(requests) != 1 || string(requests[0].GetVideoFrame()) != "test" || requests[0].GetWidth() != 1 {
+		t.Fatalf("unexpected requests: %v", requests)
+	}
+}
+
+func TestSendMessageTimeout(t *testing.T) {
+	server := grpctest.NewServer()
+	defer server.Close()
+	server.SetLatency(200 * time.Millisecond)
+
+	cfg := config.Default().Inference
+	cfg.Timeout = 20 * time.Millisecond
+	c := newMockClient(t, server, cfg)
+	_, err := c.SendMessage(context.Background(), Request{VideoFrame: []byte("test")})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestSendMessageScriptedError(t *testing.T) {
+	server := grpctest.NewServer()
+	defer server.Close()
+	server.Script(
+		grpctest.Response{Err: status.Error(codes.InvalidArgument, "bad frame")},
+		grpctest.Response{Result: "ok"},
+	)
+
+	c := newMockClient(t, server, config.Default().Inference)
+	if _, err := c.SendMessage(context.Background(), Request{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	if resp, err := c.SendMessage(context.Background(), Request{}); err != nil || resp.Label != "ok" {
+		t.Fatalf("unexpected second response %+v, %v", resp, err)
+	}
+}
+
+func TestSendMessageStructuredResult(t *testing.T) {
+	server := grpctest.NewServer()
+	defer server.Close()
+	server.SetHandler(func(ctx context.Context, req *pb.MessageRequest) (*pb.MessageResponse, error) {
+		return &pb.MessageResponse{
+			Result:       "你好",
+			Confidence:   proto.Float32(0.9),
+			Alternatives: []*pb.Alternative{{Label: "谢谢", Confidence: 0.05}},
+			Boxes:        []*pb.BoundingBox{{Label: "hand", Confidence: 0.8, X: 0.25, Y: 0.5, Width: 0.1, Height: 0.2}},
+			Keypoints:    []*pb.Keypoint{{Name: "wrist", X: 0.3, Y: 0.6, Score: 0.7}},
+			ModelVersion: "csl-v2",
+		}, nil
+	})
+
+	c := newMockClient(t, server, config.Default().Inference)
+	resp, err := c.SendMessage(context.Background(), Request{})
 	if err != nil {
 		t.Fatalf("SendMessage failed: %v", err)
 	}
-	if resp == "" {
-		t.Fatalf("SendMessage failed: empty response")
+	want := Result{
+		Label:        "你好",
+		Confidence:   0.9,
+		Alternatives: []Alternative{{Label: "谢谢", Confidence: 0.05}},
+		Boxes:        []BoundingBox{{Label: "hand", Confidence: 0.8, X: 0.25, Y: 0.5, Width: 0.1, Height: 0.2}},
+		Keypoints:    []Keypoint{{Name: "wrist", X: 0.3, Y: 0.6, Score: 0.7}},
+		ModelVersion: "csl-v2",
+	}
+	if !reflect.DeepEqual(resp, want) {
+		t.Fatalf("SendMessage() = %+v, want %+v", resp, want)
+	}
+}
+
+func TestSendMessageRoutesByModel(t *testing.T) {
+	defaultServer, csl := grpctest.NewServer(), grpctest.NewServer()
+	defer defaultServer.Close()
+	defer csl.Close()
+	defaultServer.Script(grpctest.Response{Result: "default"})
+	csl.Script(grpctest.Response{Result: "csl"})
+
+	cfg := config.Default().Inference
+	cfg.Endpoints = []string{"passthrough:///default"}
+	cfg.Models = map[string][]string{"csl": {"passthrough:///csl"}}
+	c, err := NewClient(cfg, slog.Default(), grpctest.DialOptionsFor(map[string]*grpctest.Server{"default": defaultServer, "csl": csl})...)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer c.Close()
+
+	capturedAt := time.UnixMilli(1700000000123)
+	tests := []struct {
+		req  Request
+		want string
+	}{
+		{Request{Model: "csl", SessionID: "s", TrackID: "t", Sequence: 7, RTPTimestamp: 9000, CapturedAt: capturedAt, PixelFormat: "rgba"}, "csl"},
+		{Request{Language: "csl"}, "csl"},
+		{Request{Model: "asl"}, "default"},
+		{Request{}, "default"},
+	}
+	for _, tt := range tests {
+		resp, err := c.SendMessage(context.Background(), tt.req)
+		if err != nil || resp.Label != tt.want {
+			t.Errorf("SendMessage(%+v) = %q, %v, want %q", tt.req, resp.Label, err, tt.want)
+		}
+	}
+
+	req := csl.Requests()[0]
+	if req.GetSessionId() != "s" || req.GetTrackId() != "t" || req.GetFrameSequence() != 7 || req.GetRtpTimestamp() != 9000 ||
+		req.GetCaptureTimeMs() != 1700000000123 || req.GetPixelFormat() != "rgba" || req.GetModel() != "csl" {
+		t.Fatalf("unexpected request metadata: %v", req)
+	}
+}
+
+func TestRefreshContinuesAfterFailedRoute(t *testing.T) {
+	defaultServer, csl := grpctest.NewServer(), grpctest.NewServer()
+	defer defaultServer.Close()
+	defer csl.Close()
+
+	cfg := config.Default().Inference
+	cfg.Endpoints = []string{"passthrough:///default"}
+	cfg.Models = map[string][]string{"csl": {"passthrough:///csl"}}
+	c, err := NewClient(cfg, slog.Default(), grpctest.DialOptionsFor(map[string]*grpctest.Server{"default": defaultServer, "csl": csl})...)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer c.Close()
+
+	// 默认路由解析不到任何实例，csl 路由仍应更新
+	c.routes[""].endpoints = nil
+	c.routes["csl"].endpoints = append(c.routes["csl"].endpoints, endpoint{target: "passthrough:///default"})
+	if err := c.refresh(context.Background()); !errors.Is(err, errNoBackend) {
+		t.Fatalf("refresh error = %v, want %v", err, errNoBackend)
+	}
+	if n := len(c.routes["csl"].pool.backends); n != 2 {
+		t.Fatalf("csl backends = %d, want 2", n)
+	}
+	if n := len(c.routes[""].pool.backends); n != 1 {
+		t.Fatalf("default backends = %d, want the previous 1", n)
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	server := grpctest.NewServer()
+	defer server.Close()
+	c := newMockClient(t, server, config.Default().Inference)
+
+	if !c.Healthy(context.Background()) {
+		t.Fatal("expected healthy backend")
+	}
+	server.SetServing(false)
+	if c.Healthy(context.Background()) {
+		t.Fatal("expected unhealthy backend")
 	}
-	t.Logf("SendMessage: %s", resp)
 }
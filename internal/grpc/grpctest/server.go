@@ -0,0 +1,152 @@
+// Package grpctest 提供进程内的 MessageExchange 模拟推理服务，用于不依赖 Python 服务的测试
+package grpctest
+
+import (
+	"context"
+	"fmt"
+	pb "github.com/haowei703/webrtc-server/github.com/haowei703/webrtc-server/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"sync"
+	"time"
+)
+
+const bufSize = 1 << 20
+
+// Response 一次调用的预设结果
+type Response struct {
+	Result  string
+	Err     error         // 非空时返回该错误，可使用 status.Error 构造 gRPC 状态码
+	Latency time.Duration // 返回前的额外延迟
+}
+
+// Server 可编排响应与延迟的 MessageExchange 模拟服务，基于 bufconn 运行在进程内
+type Server struct {
+	pb.UnimplementedMessageExchangeServer
+
+	mu        sync.Mutex
+	responses []Response
+	latency   time.Duration
+	handler   func(ctx context.Context, req *pb.MessageRequest) (*pb.MessageResponse, error)
+	requests  []*pb.MessageRequest
+
+	lis    *bufconn.Listener
+	server *grpc.Server
+	health *health.Server
+}
+
+// NewServer 启动模拟服务，默认对每个请求返回 "result is None"，健康检查返回 SERVING
+func NewServer() *Server {
+	s := &Server{
+		lis:    bufconn.Listen(bufSize),
+		server: grpc.NewServer(),
+		health: health.NewServer(),
+	}
+	pb.RegisterMessageExchangeServer(s.server, s)
+	healthpb.RegisterHealthServer(s.server, s.health)
+	go func() { _ = s.server.Serve(s.lis) }()
+	return s
+}
+
+// SetServing 设置健康检查的返回状态
+func (s *Server) SetServing(serving bool) {
+	status := healthpb.HealthCheckResponse_SERVING
+	if !serving {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	s.health.SetServingStatus("", status)
+}
+
+// Script 设置按顺序返回的结果，用完后重复最后一个
+func (s *Server) Script(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = responses
+}
+
+// SetLatency 设置所有调用的基础延迟
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetHandler 使用自定义函数处理请求，优先级高于 Script
+func (s *Server) SetHandler(handler func(ctx context.Context, req *pb.MessageRequest) (*pb.MessageResponse, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handler = handler
+}
+
+// Requests 返回目前收到的全部请求
+func (s *Server) Requests() []*pb.MessageRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*pb.MessageRequest(nil), s.requests...)
+}
+
+func (s *Server) SendMessage(ctx context.Context, req *pb.MessageRequest) (*pb.MessageResponse, error) {
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	handler := s.handler
+	latency := s.latency
+	resp := Response{Result: "result is None"}
+	if len(s.responses) > 0 {
+		resp = s.responses[0]
+		if len(s.responses) > 1 {
+			s.responses = s.responses[1:]
+		}
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-time.After(latency + resp.Latency):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if handler != nil {
+		return handler(ctx, req)
+	}
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return &pb.MessageResponse{Result: resp.Result}, nil
+}
+
+// Target 用于 inference.endpoints 的地址，需要配合 DialOptions 使用
+func (s *Server) Target() string {
+	return "passthrough:///bufnet"
+}
+
+// DialOptions 通过 bufconn 连接模拟服务
+func (s *Server) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return s.lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+}
+
+// DialOptionsFor 通过 bufconn 连接多个模拟服务，servers 的键为 "passthrough:///" 之后的地址，
+// 用于测试按模型路由等需要多个推理服务的场景
+func DialOptionsFor(servers map[string]*Server) []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			s, ok := servers[addr]
+			if !ok {
+				return nil, fmt.Errorf("no mock server at %s", addr)
+			}
+			return s.lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+}
+
+func (s *Server) Close() {
+	s.server.Stop()
+}
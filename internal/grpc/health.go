@@ -0,0 +1,40 @@
+package grpc
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Healthy 通过 gRPC 健康检查协议探测全部推理服务，任一实例返回 SERVING 即为 true；
+// 未实现健康检查服务的实例以连接是否就绪为准
+func (c *Client) Healthy(ctx context.Context) bool {
+	var backends []*backend
+	for _, r := range c.routes {
+		backends = append(backends, r.pool.all()...)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	results := make(chan bool, len(backends))
+	for _, b := range backends {
+		go func(b *backend) {
+			results <- checkHealth(ctx, b)
+		}(b)
+	}
+	for range backends {
+		if <-results {
+			return true
+		}
+	}
+	return false
+}
+
+func checkHealth(ctx context.Context, b *backend) bool {
+	resp, err := healthpb.NewHealthClient(b.conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return b.conn.GetState() == connectivity.Ready
+	}
+	return err == nil && resp.GetStatus() == healthpb.HealthCheckResponse_SERVING
+}
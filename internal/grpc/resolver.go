@@ -0,0 +1,81 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const dnsScheme = "dns:///"
+
+// endpoint 配置中的一个推理服务地址，带有其他 scheme（如 passthrough:///）的地址原样交给 gRPC
+type endpoint struct {
+	target string
+	dns    bool
+}
+
+// resolvedAddr 解析后的实例地址，authority 用于 TLS 校验
+type resolvedAddr struct {
+	addr      string
+	authority string
+}
+
+func parseEndpoints(targets []string) ([]endpoint, error) {
+	endpoints := make([]endpoint, 0, len(targets))
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		e := endpoint{target: target}
+		switch {
+		case strings.HasPrefix(target, dnsScheme):
+			e.target = strings.TrimPrefix(target, dnsScheme)
+			e.dns = true
+		case strings.Contains(target, ":///"):
+			endpoints = append(endpoints, e)
+			continue
+		}
+		if _, _, err := net.SplitHostPort(e.target); err != nil {
+			return nil, fmt.Errorf("invalid inference endpoint %q: %w", target, err)
+		}
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, nil
+}
+
+// resolve 解析全部地址，DNS 地址展开为每个 IP 一个实例
+func resolve(ctx context.Context, endpoints []endpoint) ([]resolvedAddr, error) {
+	var addrs []resolvedAddr
+	seen := make(map[string]bool)
+	for _, e := range endpoints {
+		if !e.dns {
+			if !seen[e.target] {
+				seen[e.target] = true
+				addrs = append(addrs, resolvedAddr{addr: e.target})
+			}
+			continue
+		}
+		host, port, _ := net.SplitHostPort(e.target)
+		ips, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", host, err)
+		}
+		for _, ip := range ips {
+			addr := net.JoinHostPort(ip, port)
+			if !seen[addr] {
+				seen[addr] = true
+				addrs = append(addrs, resolvedAddr{addr: addr, authority: e.target})
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// hasDNS 是否存在需要定期重新解析的地址
+func hasDNS(endpoints []endpoint) bool {
+	for _, e := range endpoints {
+		if e.dns {
+			return true
+		}
+	}
+	return false
+}
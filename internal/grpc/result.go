@@ -0,0 +1,70 @@
+package grpc
+
+import (
+	pb "github.com/haowei703/webrtc-server/github.com/haowei703/webrtc-server/proto"
+	"math"
+)
+
+// Result 推理服务对一帧的识别结果，JSON 字段与下发给客户端的 text 消息一致
+type Result struct {
+	Label string `json:"label"`
+	// Confidence 取值 [0, 1]，推理服务未提供时为 1
+	Confidence   float64       `json:"confidence"`
+	Alternatives []Alternative `json:"alternatives,omitempty"`
+	Boxes        []BoundingBox `json:"boxes,omitempty"`
+	Keypoints    []Keypoint    `json:"keypoints,omitempty"`
+	ModelVersion string        `json:"model_version,omitempty"`
+}
+
+// Alternative 候选识别结果
+type Alternative struct {
+	Label      string  `json:"label"`
+	Confidence float64 `json:"confidence"`
+}
+
+// BoundingBox 坐标按帧宽高归一化到 [0, 1]
+type BoundingBox struct {
+	Label      string  `json:"label,omitempty"`
+	Confidence float64 `json:"confidence"`
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	Width      float64 `json:"width"`
+	Height     float64 `json:"height"`
+}
+
+// Keypoint 坐标按帧宽高归一化到 [0, 1]
+type Keypoint struct {
+	Name  string  `json:"name,omitempty"`
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+	Score float64 `json:"score"`
+}
+
+// newResult 转换推理服务的响应，float32 转换时保留 4 位小数以避免 0.9 变为 0.8999999761581421
+func newResult(r *pb.MessageResponse) Result {
+	result := Result{Label: r.GetResult(), Confidence: 1, ModelVersion: r.GetModelVersion()}
+	if r.Confidence != nil {
+		result.Confidence = round(r.GetConfidence())
+	}
+	for _, a := range r.GetAlternatives() {
+		result.Alternatives = append(result.Alternatives, Alternative{Label: a.GetLabel(), Confidence: round(a.GetConfidence())})
+	}
+	for _, b := range r.GetBoxes() {
+		result.Boxes = append(result.Boxes, BoundingBox{
+			Label:      b.GetLabel(),
+			Confidence: round(b.GetConfidence()),
+			X:          round(b.GetX()),
+			Y:          round(b.GetY()),
+			Width:      round(b.GetWidth()),
+			Height:     round(b.GetHeight()),
+		})
+	}
+	for _, k := range r.GetKeypoints() {
+		result.Keypoints = append(result.Keypoints, Keypoint{Name: k.GetName(), X: round(k.GetX()), Y: round(k.GetY()), Score: round(k.GetScore())})
+	}
+	return result
+}
+
+func round(v float32) float64 {
+	return math.Round(float64(v)*1e4) / 1e4
+}
@@ -0,0 +1,88 @@
+// Package keyframe 按编码判断一帧完整的视频数据是否为关键帧，H.264/H.265 需为 Annex-B 格式
+package keyframe
+
+import "strings"
+
+// For 返回 codec（VP8、VP9、H264 或 H265，不区分大小写）的关键帧判断函数，不支持的编码返回 nil
+func For(codec string) func(frame []byte) bool {
+	switch strings.ToUpper(codec) {
+	case "VP8":
+		return VP8
+	case "VP9":
+		return VP9
+	case "H264":
+		return H264
+	case "H265":
+		return H265
+	}
+	return nil
+}
+
+// VP8 帧标签首位 P 为 0 表示关键帧
+func VP8(frame []byte) bool {
+	return len(frame) > 0 && frame[0]&0x01 == 0
+}
+
+// VP9 解析未压缩帧头：frame_marker(2) profile(2) [reserved(1)] show_existing_frame(1) frame_type(1)
+func VP9(frame []byte) bool {
+	if len(frame) == 0 || frame[0]>>6 != 0b10 {
+		return false
+	}
+	b := frame[0]
+	profile := (b>>5)&1 | (b>>4)&1<<1
+	pos := 4
+	if profile == 3 {
+		pos++
+	}
+	showExisting := b >> (7 - pos) & 1
+	frameType := b >> (6 - pos) & 1
+	return showExisting == 0 && frameType == 0
+}
+
+// H264 帧中包含 IDR 或 SPS
+func H264(frame []byte) bool {
+	for _, nal := range annexBUnits(frame) {
+		switch nal[0] & 0x1f {
+		case 5, 7:
+			return true
+		}
+	}
+	return false
+}
+
+// H265 帧中包含 IRAP（BLA/IDR/CRA）或 VPS
+func H265(frame []byte) bool {
+	for _, nal := range annexBUnits(frame) {
+		t := nal[0] >> 1 & 0x3f
+		if t >= 16 && t <= 21 || t == 32 {
+			return true
+		}
+	}
+	return false
+}
+
+// annexBUnits 按起始码拆分 NAL 单元，不复制数据
+func annexBUnits(data []byte) [][]byte {
+	var units [][]byte
+	start := -1
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] != 0 || data[i+1] != 0 || data[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			end := i
+			if end > start && data[end-1] == 0 {
+				end-- // 4 字节起始码
+			}
+			if end > start {
+				units = append(units, data[start:end])
+			}
+		}
+		start = i + 3
+		i += 2
+	}
+	if start >= 0 && start < len(data) {
+		units = append(units, data[start:])
+	}
+	return units
+}
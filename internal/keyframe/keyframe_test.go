@@ -0,0 +1,23 @@
+package keyframe
+
+import "testing"
+
+func TestVP9(t *testing.T) {
+	for b, want := range map[byte]bool{
+		0b1000_0000: true,  // profile 0 关键帧
+		0b1000_0100: false, // profile 0 非关键帧
+		0b1000_1000: false, // show_existing_frame
+		0b1011_0000: true,  // profile 3 关键帧
+		0b0000_0000: false, // frame_marker 错误
+	} {
+		if got := VP9([]byte{b}); got != want {
+			t.Errorf("VP9(%08b) = %v, want %v", b, got, want)
+		}
+	}
+}
+
+func TestFor(t *testing.T) {
+	if For("vp8") == nil || For("H265") == nil || For("AV1") != nil {
+		t.Fatal("unexpected codec mapping")
+	}
+}
@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// 结构化日志中通用的字段名
+const (
+	KeySession = "session_id"
+	KeyTrack   = "track_id"
+	KeySSRC    = "ssrc"
+	KeyCodec   = "codec"
+)
+
+// Options 日志配置
+type Options struct {
+	Level  string // debug, info, warn, error，默认 info
+	Format string // text 或 json，默认 text
+}
+
+// New 按配置创建结构化日志记录器
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	handlerOpts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+	return slog.New(handler), nil
+}
+
+// ParseLevel 解析日志级别，空字符串视为 info
+func ParseLevel(s string) (slog.Level, error) {
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
@@ -0,0 +1,146 @@
+// Package mediafile 读取预先编码的视频文件（IVF、H.264 Annex-B），供压测与回放工具使用
+package mediafile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media/h264reader"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultFPS 文件中没有时间信息时假定的帧率
+const defaultFPS = 30
+
+// Clip 读入内存的编码视频，只读，可在多个会话间共享
+type Clip struct {
+	MimeType string
+	// FPS 文件自带的帧率，未知时为 0
+	FPS    float64
+	Frames []Frame
+}
+
+// Frame 一帧编码数据，Timestamp 为相对第一帧的时间
+type Frame struct {
+	Data      []byte
+	Timestamp time.Duration
+}
+
+var annexBStartCode = []byte{0, 0, 0, 1}
+
+// Load 根据扩展名读取 IVF（VP8/VP9）或 H.264 Annex-B 文件
+func Load(path string) (*Clip, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var c *Clip
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ivf":
+		c, err = ReadIVF(f)
+	case ".h264", ".264":
+		c, err = ReadH264(f)
+	default:
+		return nil, fmt.Errorf("unsupported file %s: expected .ivf or .h264", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if len(c.Frames) == 0 {
+		return nil, fmt.Errorf("%s contains no frames", path)
+	}
+	return c, nil
+}
+
+// ReadIVF 读取 IVF 文件，帧时间取自 IVF 的时间基与 PTS
+func ReadIVF(r io.Reader) (*Clip, error) {
+	reader, header, err := ivfreader.NewWith(r)
+	if err != nil {
+		return nil, err
+	}
+	c := &Clip{}
+	switch header.FourCC {
+	case "VP80":
+		c.MimeType = webrtc.MimeTypeVP8
+	case "VP90":
+		c.MimeType = webrtc.MimeTypeVP9
+	default:
+		return nil, fmt.Errorf("unsupported IVF codec %q", header.FourCC)
+	}
+	// 时间基为 numerator/denominator 秒
+	num, den := uint64(1), uint64(defaultFPS)
+	if header.TimebaseNumerator > 0 && header.TimebaseDenominator > 0 {
+		num, den = uint64(header.TimebaseNumerator), uint64(header.TimebaseDenominator)
+		// 时间基为帧间隔时（如 1/30）才代表帧率，录制文件使用 1/90000
+		if den/num <= 240 {
+			c.FPS = float64(den) / float64(num)
+		}
+	}
+	var first uint64
+	for {
+		frame, frameHeader, err := reader.ParseNextFrame()
+		if errors.Is(err, io.EOF) {
+			return c, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(c.Frames) == 0 {
+			first = frameHeader.Timestamp
+		}
+		c.Frames = append(c.Frames, Frame{Data: frame, Timestamp: time.Duration((frameHeader.Timestamp-first)*num) * time.Second / time.Duration(den)})
+	}
+}
+
+// ReadH264 将 NAL 单元按访问单元合并为帧，新帧从 first_mb_in_slice 为 0 的 slice
+// 或 slice 之后出现的非 VCL 单元（SPS、PPS、SEI、AUD 等）开始。
+// Annex-B 没有时间信息，按 30fps 计算帧时间
+func ReadH264(r io.Reader) (*Clip, error) {
+	reader, err := h264reader.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	c := &Clip{MimeType: webrtc.MimeTypeH264}
+	var frame bytes.Buffer
+	sawSlice := false
+	flush := func() {
+		c.Frames = append(c.Frames, Frame{
+			Data:      bytes.Clone(frame.Bytes()),
+			Timestamp: time.Duration(len(c.Frames)) * time.Second / defaultFPS,
+		})
+		frame.Reset()
+		sawSlice = false
+	}
+	for {
+		nal, err := reader.NextNAL()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		isSlice := nal.UnitType == h264reader.NalUnitTypeCodedSliceNonIdr || nal.UnitType == h264reader.NalUnitTypeCodedSliceIdr
+		// slice header 以 ue(v) 编码的 first_mb_in_slice 开头，首位为 1 表示值为 0
+		newPicture := isSlice && len(nal.Data) > 1 && nal.Data[1]&0x80 != 0
+		if sawSlice && (!isSlice || newPicture) {
+			flush()
+		}
+		frame.Write(annexBStartCode)
+		frame.Write(nal.Data)
+		if isSlice {
+			sawSlice = true
+		}
+	}
+	if sawSlice {
+		flush()
+	}
+	return c, nil
+}
@@ -0,0 +1,70 @@
+package mediafile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestReadH264GroupsAccessUnits(t *testing.T) {
+	sps := []byte{0x67, 0x42}
+	pps := []byte{0x68, 0xce}
+	idr := []byte{0x65, 0x88, 0x01}       // first_mb_in_slice = 0
+	idrSlice2 := []byte{0x65, 0x40, 0x02} // first_mb_in_slice != 0，属于同一帧
+	p := []byte{0x41, 0x9a, 0x03}
+
+	var stream []byte
+	for _, nal := range [][]byte{sps, pps, idr, idrSlice2, p, p} {
+		stream = append(stream, annexBStartCode...)
+		stream = append(stream, nal...)
+	}
+
+	c, err := ReadH264(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Frames) != 3 {
+		t.Fatalf("got %d frames, want 3", len(c.Frames))
+	}
+	var want []byte
+	for _, nal := range [][]byte{sps, pps, idr, idrSlice2} {
+		want = append(want, annexBStartCode...)
+		want = append(want, nal...)
+	}
+	if !bytes.Equal(c.Frames[0].Data, want) {
+		t.Errorf("first frame = %x, want %x", c.Frames[0].Data, want)
+	}
+	if c.Frames[2].Timestamp != 2*time.Second/30 {
+		t.Errorf("third frame timestamp = %v", c.Frames[2].Timestamp)
+	}
+}
+
+func TestReadIVFTimestamps(t *testing.T) {
+	var buf bytes.Buffer
+	header := make([]byte, 32)
+	copy(header, "DKIF")
+	binary.LittleEndian.PutUint16(header[6:], 32)
+	copy(header[8:], "VP90")
+	binary.LittleEndian.PutUint32(header[16:], 90000)
+	binary.LittleEndian.PutUint32(header[20:], 1)
+	buf.Write(header)
+	for _, pts := range []uint64{1000, 4000} {
+		frameHeader := make([]byte, 12)
+		binary.LittleEndian.PutUint32(frameHeader, 1)
+		binary.LittleEndian.PutUint64(frameHeader[4:], pts)
+		buf.Write(frameHeader)
+		buf.WriteByte(0x80)
+	}
+
+	c, err := ReadIVF(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.MimeType != "video/VP9" || c.FPS != 0 || len(c.Frames) != 2 {
+		t.Fatalf("unexpected clip: %+v", c)
+	}
+	if got := c.Frames[1].Timestamp; got != time.Duration(3000)*time.Second/90000 {
+		t.Errorf("second frame timestamp = %v", got)
+	}
+}
@@ -0,0 +1,47 @@
+// Package ratelimit 实现信令的会话配额与消息速率限制
+package ratelimit
+
+import (
+	"time"
+)
+
+// Bucket 令牌桶，rate 为每秒补充的令牌数，burst 为容量；非并发安全
+type Bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewBucket(rate float64, burst int, now time.Time) *Bucket {
+	return &Bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// Allow 取出一个令牌，令牌不足时返回 false
+func (b *Bucket) Allow(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Ready 是否有可取的令牌，不消耗令牌
+func (b *Bucket) Ready(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= 1
+}
+
+// Full 令牌桶是否已补满，补满的桶可以丢弃
+func (b *Bucket) Full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+func (b *Bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
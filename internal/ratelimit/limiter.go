@@ -0,0 +1,166 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrServerBusy 全局会话数已达上限
+	ErrServerBusy = errors.New("server busy")
+	// ErrTooManySessions 某个 IP 或身份的并发会话数已达上限
+	ErrTooManySessions = errors.New("too many concurrent sessions")
+	// ErrSessionRate 某个 IP 或身份新建会话过于频繁
+	ErrSessionRate = errors.New("too many new sessions")
+)
+
+// sweepInterval 清理空闲客户端记录的间隔
+const sweepInterval = time.Minute
+
+// Limiter 按全局、客户端 IP 与身份限制会话数与消息速率
+type Limiter struct {
+	cfg config.LimitsConfig
+	// now 返回当前时间，测试时可替换
+	now func() time.Time
+
+	mu         sync.Mutex
+	active     int
+	ips        map[string]*client
+	identities map[string]*client
+	lastSweep  time.Time
+}
+
+// client 一个 IP 或身份的配额状态
+type client struct {
+	quota    config.QuotaConfig
+	active   int
+	sessions *Bucket
+	messages *Bucket
+}
+
+func NewLimiter(cfg config.LimitsConfig) *Limiter {
+	return &Limiter{
+		cfg:        cfg,
+		now:        time.Now,
+		ips:        make(map[string]*client),
+		identities: make(map[string]*client),
+	}
+}
+
+// Lease 一个已准入的会话，会话结束时需调用 Release
+type Lease struct {
+	limiter *Limiter
+	clients []*client
+	once    sync.Once
+}
+
+// Admit 检查配额并占用一个会话，identity 为空时只按 IP 限制
+func (l *Limiter) Admit(ip, identity string) (*Lease, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	if l.cfg.MaxSessions > 0 && l.active >= l.cfg.MaxSessions {
+		return nil, ErrServerBusy
+	}
+	clients := []*client{l.client(l.ips, ip, l.cfg.PerIP, now)}
+	if identity != "" {
+		clients = append(clients, l.client(l.identities, identity, l.cfg.PerIdentity, now))
+	}
+	names := []string{"ip " + ip, "identity " + identity}
+	for i, c := range clients {
+		if c.quota.MaxSessions > 0 && c.active >= c.quota.MaxSessions {
+			return nil, fmt.Errorf("%s: %w", names[i], ErrTooManySessions)
+		}
+	}
+	// 所有检查通过后才消耗新建会话的令牌，避免被拒绝的连接占用配额
+	for i, c := range clients {
+		if c.sessions != nil && !c.sessions.Ready(now) {
+			return nil, fmt.Errorf("%s: %w", names[i], ErrSessionRate)
+		}
+	}
+
+	l.active++
+	for _, c := range clients {
+		if c.sessions != nil {
+			c.sessions.Allow(now)
+		}
+		c.active++
+	}
+	return &Lease{limiter: l, clients: clients}, nil
+}
+
+// Active 返回当前占用的会话数
+func (l *Limiter) Active() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active
+}
+
+// client 查找或创建客户端记录，调用方需持有 mu
+func (l *Limiter) client(clients map[string]*client, key string, quota config.QuotaConfig, now time.Time) *client {
+	c, ok := clients[key]
+	if ok {
+		return c
+	}
+	c = &client{quota: quota}
+	if quota.SessionsPerMinute > 0 {
+		c.sessions = NewBucket(float64(quota.SessionsPerMinute)/60, quota.SessionsPerMinute, now)
+	}
+	if quota.MessageRate > 0 {
+		c.messages = NewBucket(quota.MessageRate, quota.MessageBurst, now)
+	}
+	clients[key] = c
+	return c
+}
+
+// sweep 删除没有会话且令牌已补满的客户端记录，调用方需持有 mu
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for _, clients := range []map[string]*client{l.ips, l.identities} {
+		for key, c := range clients {
+			if c.active == 0 && (c.sessions == nil || c.sessions.Full(now)) && (c.messages == nil || c.messages.Full(now)) {
+				delete(clients, key)
+			}
+		}
+	}
+}
+
+// AllowMessage 按会话所属的 IP 与身份检查消息速率，超出时返回 false
+func (lease *Lease) AllowMessage() bool {
+	l := lease.limiter
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for _, c := range lease.clients {
+		if c.messages != nil && !c.messages.Ready(now) {
+			return false
+		}
+	}
+	for _, c := range lease.clients {
+		if c.messages != nil {
+			c.messages.Allow(now)
+		}
+	}
+	return true
+}
+
+// Release 释放会话占用的配额，可重复调用
+func (lease *Lease) Release() {
+	lease.once.Do(func() {
+		l := lease.limiter
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.active--
+		for _, c := range lease.clients {
+			c.active--
+		}
+	})
+}
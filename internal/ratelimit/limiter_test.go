@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"errors"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(cfg config.LimitsConfig) (*Limiter, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	l := NewLimiter(cfg)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLimiterConcurrentSessions(t *testing.T) {
+	l, _ := newTestLimiter(config.LimitsConfig{
+		MaxSessions: 3,
+		PerIP:       config.QuotaConfig{MaxSessions: 2},
+	})
+
+	a, err := l.Admit("10.0.0.1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Admit("10.0.0.1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Admit("10.0.0.1", ""); !errors.Is(err, ErrTooManySessions) {
+		t.Fatalf("third session from the same ip: got %v, want %v", err, ErrTooManySessions)
+	}
+	if _, err := l.Admit("10.0.0.2", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Admit("10.0.0.3", ""); !errors.Is(err, ErrServerBusy) {
+		t.Fatalf("global cap: got %v, want %v", err, ErrServerBusy)
+	}
+
+	a.Release()
+	a.Release()
+	if got := l.Active(); got != 2 {
+		t.Fatalf("active = %d after release, want 2", got)
+	}
+	if _, err := l.Admit("10.0.0.1", ""); err != nil {
+		t.Fatalf("session after release: %v", err)
+	}
+}
+
+func TestLimiterSessionRate(t *testing.T) {
+	l, now := newTestLimiter(config.LimitsConfig{
+		PerIP:       config.QuotaConfig{SessionsPerMinute: 60},
+		PerIdentity: config.QuotaConfig{SessionsPerMinute: 2},
+	})
+
+	for i := 0; i < 2; i++ {
+		lease, err := l.Admit("10.0.0.1", "svc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lease.Release()
+	}
+	if _, err := l.Admit("10.0.0.2", "svc"); !errors.Is(err, ErrSessionRate) {
+		t.Fatalf("got %v, want %v", err, ErrSessionRate)
+	}
+	if _, err := l.Admit("10.0.0.2", ""); err != nil {
+		t.Fatalf("ip without identity: %v", err)
+	}
+
+	*now = now.Add(30 * time.Second)
+	if _, err := l.Admit("10.0.0.1", "svc"); err != nil {
+		t.Fatalf("after refill: %v", err)
+	}
+}
+
+func TestLimiterRejectionKeepsTokens(t *testing.T) {
+	l, _ := newTestLimiter(config.LimitsConfig{
+		PerIP:       config.QuotaConfig{SessionsPerMinute: 1},
+		PerIdentity: config.QuotaConfig{SessionsPerMinute: 1},
+	})
+	if _, err := l.Admit("10.0.0.1", "svc"); err != nil {
+		t.Fatal(err)
+	}
+	// 身份配额拒绝时不消耗该 IP 的令牌
+	if _, err := l.Admit("10.0.0.2", "svc"); !errors.Is(err, ErrSessionRate) {
+		t.Fatalf("got %v, want %v", err, ErrSessionRate)
+	}
+	if _, err := l.Admit("10.0.0.2", ""); err != nil {
+		t.Fatalf("ip token consumed by rejected session: %v", err)
+	}
+}
+
+func TestLeaseAllowMessage(t *testing.T) {
+	l, now := newTestLimiter(config.LimitsConfig{
+		PerIP: config.QuotaConfig{MessageRate: 10, MessageBurst: 5},
+	})
+	a, _ := l.Admit("10.0.0.1", "")
+	b, _ := l.Admit("10.0.0.1", "")
+
+	// 同一 IP 的会话共享消息配额
+	for i := 0; i < 5; i++ {
+		lease := a
+		if i%2 == 1 {
+			lease = b
+		}
+		if !lease.AllowMessage() {
+			t.Fatalf("message %d rejected within burst", i)
+		}
+	}
+	if a.AllowMessage() {
+		t.Fatal("message accepted beyond burst")
+	}
+	*now = now.Add(200 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if !b.AllowMessage() {
+			t.Fatalf("message %d rejected after refill", i)
+		}
+	}
+	if b.AllowMessage() {
+		t.Fatal("message accepted beyond refill")
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l, now := newTestLimiter(config.LimitsConfig{
+		PerIP: config.QuotaConfig{SessionsPerMinute: 1},
+	})
+	lease, err := l.Admit("10.0.0.1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lease.Release()
+
+	*now = now.Add(2 * time.Minute)
+	if _, err := l.Admit("10.0.0.2", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.ips["10.0.0.1"]; ok {
+		t.Fatal("idle client not swept")
+	}
+}
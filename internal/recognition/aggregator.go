@@ -0,0 +1,156 @@
+// Package recognition 将逐帧的手语识别结果聚合为手语词与句子
+package recognition
+
+import (
+	"github.com/haowei703/webrtc-server/internal/config"
+	"strings"
+	"time"
+)
+
+// Observation 一帧的识别结果，Label 为空表示该帧没有识别到手语
+type Observation struct {
+	Label      string
+	Confidence float64
+	At         time.Time
+}
+
+// Event 聚合结果的变化
+type Event struct {
+	// Sentence 当前句子的全部内容，中间结果包含尚未确认的手语词
+	Sentence string
+	// Gloss 正在识别、尚未确认的手语词
+	Gloss string
+	// Final 为 true 表示句子已结束，之后的结果属于新的句子
+	Final bool
+}
+
+// Aggregator 基于滑动窗口的置信度投票确认手语词，并按停顿切分词与句子，非并发安全
+type Aggregator struct {
+	cfg       config.AggregatorConfig
+	window    []Observation
+	words     []string
+	gloss     string
+	idleSince time.Time
+	last      string
+}
+
+func NewAggregator(cfg config.AggregatorConfig) *Aggregator {
+	return &Aggregator{cfg: cfg}
+}
+
+// Add 加入一帧结果，返回由此产生的事件
+func (a *Aggregator) Add(obs Observation) []Event {
+	if obs.Confidence < a.cfg.MinConfidence {
+		obs.Label = ""
+	}
+	a.window = append(a.window, obs)
+	cut := 0
+	for cut < len(a.window) && obs.At.Sub(a.window[cut].At) > a.cfg.Window {
+		cut++
+	}
+	a.window = a.window[cut:]
+
+	// 停顿按逐帧结果计算，词的确认按投票结果计算
+	if obs.Label != "" {
+		a.idleSince = time.Time{}
+	} else if a.idleSince.IsZero() {
+		a.idleSince = obs.At
+	}
+
+	var events []Event
+	if label, ok := a.vote(); ok && label != "" && label != a.gloss {
+		if a.gloss != "" {
+			events = append(events, a.commit()...)
+		}
+		a.gloss = label
+	}
+
+	if !a.idleSince.IsZero() {
+		idle := obs.At.Sub(a.idleSince)
+		if idle >= a.cfg.SignGap && a.gloss != "" {
+			events = append(events, a.commit()...)
+			a.window = a.window[:0]
+		}
+		if idle >= a.cfg.SentenceGap && len(a.words) > 0 {
+			events = append(events, a.final())
+		}
+	}
+	if e, ok := a.interim(); ok {
+		events = append(events, e)
+	}
+	return events
+}
+
+// Flush 结束当前句子，用于会话结束或视频中断
+func (a *Aggregator) Flush() []Event {
+	if a.gloss != "" {
+		if events := a.commit(); len(events) > 0 {
+			return events
+		}
+	}
+	if len(a.words) == 0 {
+		return nil
+	}
+	return []Event{a.final()}
+}
+
+// vote 返回窗口内置信度之和占比最高且满足阈值的结果
+func (a *Aggregator) vote() (string, bool) {
+	scores := make(map[string]float64)
+	counts := make(map[string]int)
+	var total float64
+	for _, o := range a.window {
+		scores[o.Label] += o.Confidence
+		counts[o.Label]++
+		total += o.Confidence
+	}
+	if total <= 0 {
+		return "", false
+	}
+	best, bestScore := "", -1.0
+	for label, score := range scores {
+		if score > bestScore || (score == bestScore && label < best) {
+			best, bestScore = label, score
+		}
+	}
+	if counts[best] < a.cfg.MinFrames || bestScore/total < a.cfg.VoteThreshold {
+		return "", false
+	}
+	return best, true
+}
+
+// commit 确认当前手语词，达到句子最大词数时返回最终结果
+func (a *Aggregator) commit() []Event {
+	a.words = append(a.words, a.gloss)
+	a.gloss = ""
+	if a.cfg.MaxWords > 0 && len(a.words) >= a.cfg.MaxWords {
+		return []Event{a.final()}
+	}
+	return nil
+}
+
+func (a *Aggregator) final() Event {
+	e := Event{Sentence: strings.Join(a.words, a.cfg.Separator), Final: true}
+	a.words = nil
+	a.gloss = ""
+	a.last = ""
+	a.window = a.window[:0]
+	return e
+}
+
+// interim 句子内容变化时返回中间结果
+func (a *Aggregator) interim() (Event, bool) {
+	parts := a.words
+	if a.gloss != "" {
+		parts = append(parts[:len(parts):len(parts)], a.gloss)
+	}
+	sentence := strings.Join(parts, a.cfg.Separator)
+	if sentence == a.last {
+		return Event{}, false
+	}
+	a.last = sentence
+	if sentence == "" {
+		return Event{}, false
+	}
+	return Event{Sentence: sentence, Gloss: a.gloss}, true
+}
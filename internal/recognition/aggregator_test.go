@@ -0,0 +1,110 @@
+package recognition
+
+import (
+	"github.com/haowei703/webrtc-server/internal/config"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testConfig = config.AggregatorConfig{
+	Window:        time.Second,
+	VoteThreshold: 0.5,
+	MinFrames:     3,
+	MinConfidence: 0.3,
+	SignGap:       500 * time.Millisecond,
+	SentenceGap:   2 * time.Second,
+	MaxWords:      20,
+	Separator:     " ",
+}
+
+// feed 以 100ms 的间隔依次加入结果，返回全部事件
+func feed(a *Aggregator, start time.Time, labels ...string) ([]Event, time.Time) {
+	var events []Event
+	at := start
+	for _, label := range labels {
+		events = append(events, a.Add(Observation{Label: label, Confidence: 1, At: at})...)
+		at = at.Add(100 * time.Millisecond)
+	}
+	return events, at
+}
+
+func repeat(label string, n int) []string {
+	labels := make([]string, n)
+	for i := range labels {
+		labels[i] = label
+	}
+	return labels
+}
+
+func TestAggregatorSentence(t *testing.T) {
+	a := NewAggregator(testConfig)
+	var labels []string
+	labels = append(labels, repeat("你好", 5)...)
+	labels = append(labels, repeat("", 6)...)
+	labels = append(labels, repeat("谢谢", 5)...)
+	labels = append(labels, repeat("", 25)...)
+	events, _ := feed(a, time.Unix(0, 0), labels...)
+
+	want := []Event{
+		{Sentence: "你好", Gloss: "你好"},
+		{Sentence: "你好 谢谢", Gloss: "谢谢"},
+		{Sentence: "你好 谢谢", Final: true},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("events = %+v, want %+v", events, want)
+	}
+}
+
+func TestAggregatorVotingRejectsFlicker(t *testing.T) {
+	a := NewAggregator(testConfig)
+	// 单帧的误识别不足以改变投票结果
+	events, _ := feed(a, time.Unix(0, 0), "你好", "你好", "再见", "你好", "你好", "你好")
+	want := []Event{{Sentence: "你好", Gloss: "你好"}}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("events = %+v, want %+v", events, want)
+	}
+	if got := a.Flush(); !reflect.DeepEqual(got, []Event{{Sentence: "你好", Final: true}}) {
+		t.Fatalf("Flush() = %+v", got)
+	}
+}
+
+func TestAggregatorLowConfidenceIsIdle(t *testing.T) {
+	a := NewAggregator(testConfig)
+	var events []Event
+	at := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		events = append(events, a.Add(Observation{Label: "你好", Confidence: 0.2, At: at})...)
+		at = at.Add(100 * time.Millisecond)
+	}
+	if len(events) != 0 {
+		t.Fatalf("events = %+v, want none", events)
+	}
+	if got := a.Flush(); got != nil {
+		t.Fatalf("Flush() = %+v, want nil", got)
+	}
+}
+
+func TestAggregatorMaxWords(t *testing.T) {
+	cfg := testConfig
+	cfg.MaxWords = 2
+	a := NewAggregator(cfg)
+	var labels []string
+	labels = append(labels, repeat("一", 6)...)
+	labels = append(labels, repeat("二", 6)...)
+	labels = append(labels, repeat("三", 6)...)
+	events, _ := feed(a, time.Unix(0, 0), labels...)
+
+	var finals []string
+	for _, e := range events {
+		if e.Final {
+			finals = append(finals, e.Sentence)
+		}
+	}
+	if !reflect.DeepEqual(finals, []string{"一 二"}) {
+		t.Fatalf("finals = %v, want [一 二]", finals)
+	}
+	if last := events[len(events)-1]; last.Final || last.Sentence != "三" {
+		t.Fatalf("last event = %+v, want interim 三", last)
+	}
+}
@@ -0,0 +1,162 @@
+package recognition
+
+import (
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Clock 返回当前时间，测试时可替换
+type Clock func() time.Time
+
+// ResultFilter 决定逐帧的识别结果是否下发给客户端，实现可以有状态，非并发安全
+type ResultFilter interface {
+	// Accept 返回 true 表示下发该结果，Observation.At 不被使用，时间由各实现的 Clock 给出
+	Accept(obs Observation) bool
+}
+
+// TimeDedup 同一结果在 Period 内只下发一次
+type TimeDedup struct {
+	Period time.Duration
+	clock  Clock
+	last   string
+	at     time.Time
+}
+
+func NewTimeDedup(period time.Duration, clock Clock) *TimeDedup {
+	return &TimeDedup{Period: period, clock: clock}
+}
+
+func (f *TimeDedup) Accept(obs Observation) bool {
+	now := f.clock()
+	if obs.Label == f.last && !f.at.IsZero() && now.Sub(f.at) < f.Period {
+		return false
+	}
+	f.last = obs.Label
+	f.at = now
+	return true
+}
+
+// Consecutive 同一结果连续出现 Count 次时下发一次，直到结果变化
+type Consecutive struct {
+	Count int
+	last  string
+	run   int
+}
+
+func NewConsecutive(count int) *Consecutive {
+	return &Consecutive{Count: count}
+}
+
+func (f *Consecutive) Accept(obs Observation) bool {
+	if obs.Label != f.last {
+		f.last = obs.Label
+		f.run = 0
+	}
+	f.run++
+	return f.run == f.Count
+}
+
+// ConfidenceThreshold 丢弃置信度低于 Min 的结果
+type ConfidenceThreshold struct {
+	Min float64
+}
+
+func (f ConfidenceThreshold) Accept(obs Observation) bool {
+	return obs.Confidence >= f.Min
+}
+
+// Hysteresis 结果的置信度达到 Enter 时下发并保持激活，降到 Exit 以下才解除，避免在阈值附近反复下发
+type Hysteresis struct {
+	Enter  float64
+	Exit   float64
+	active string
+	on     bool
+}
+
+func NewHysteresis(enter, exit float64) *Hysteresis {
+	return &Hysteresis{Enter: enter, Exit: exit}
+}
+
+func (f *Hysteresis) Accept(obs Observation) bool {
+	if f.on && obs.Label == f.active {
+		if obs.Confidence < f.Exit {
+			f.on = false
+		}
+		return false
+	}
+	// 其他结果达到 Enter 才替换当前结果
+	if obs.Confidence >= f.Enter {
+		f.active, f.on = obs.Label, true
+		return true
+	}
+	return false
+}
+
+// Chain 按顺序组合多个过滤器，前一个过滤器拒绝的结果不会交给后面的过滤器
+type Chain []ResultFilter
+
+func (c Chain) Accept(obs Observation) bool {
+	for _, f := range c {
+		if !f.Accept(obs) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewFilter 按配置依次组合过滤器，配置需已通过 Validate
+func NewFilter(cfgs []config.FilterConfig, clock Clock) Chain {
+	chain := make(Chain, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		switch cfg.Type {
+		case "dedup":
+			chain = append(chain, NewTimeDedup(cfg.Period, clock))
+		case "consecutive":
+			chain = append(chain, NewConsecutive(cfg.Count))
+		case "confidence":
+			chain = append(chain, ConfidenceThreshold{Min: cfg.Min})
+		case "hysteresis":
+			chain = append(chain, NewHysteresis(cfg.Enter, cfg.Exit))
+		}
+	}
+	return chain
+}
+
+// ParseFilters 解析客户端指定的过滤器，格式为逗号分隔的 type:参数，例如
+// "confidence:0.6,consecutive:3,dedup:2s"，hysteresis 的参数为 enter/exit，例如 "hysteresis:0.7/0.4"
+func ParseFilters(spec string) ([]config.FilterConfig, error) {
+	var cfgs []config.FilterConfig
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		typ, arg, _ := strings.Cut(item, ":")
+		cfg := config.FilterConfig{Type: typ}
+		var err error
+		switch typ {
+		case "dedup":
+			cfg.Period, err = time.ParseDuration(arg)
+		case "consecutive":
+			cfg.Count, err = strconv.Atoi(arg)
+		case "confidence":
+			cfg.Min, err = strconv.ParseFloat(arg, 64)
+		case "hysteresis":
+			enter, exit, _ := strings.Cut(arg, "/")
+			if cfg.Enter, err = strconv.ParseFloat(enter, 64); err == nil {
+				cfg.Exit, err = strconv.ParseFloat(exit, 64)
+			}
+		}
+		if err == nil {
+			err = cfg.Validate()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("filter %q: %w", item, err)
+		}
+		cfgs = append(cfgs, cfg)
+	}
+	return cfgs, nil
+}
@@ -0,0 +1,122 @@
+package recognition
+
+import (
+	"github.com/haowei703/webrtc-server/internal/config"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeClock 测试用的可手动推进的时钟
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func obs(label string, confidence float64) Observation {
+	return Observation{Label: label, Confidence: confidence}
+}
+
+// accepted 依次交给过滤器，返回被接受的结果，每个结果之间时钟前进 step
+func accepted(f ResultFilter, clock *fakeClock, step time.Duration, inputs ...Observation) []string {
+	var out []string
+	for _, o := range inputs {
+		if f.Accept(o) {
+			out = append(out, o.Label)
+		}
+		if clock != nil {
+			clock.Advance(step)
+		}
+	}
+	return out
+}
+
+func TestTimeDedup(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(100, 0)}
+	f := NewTimeDedup(2*time.Second, clock.Now)
+	got := accepted(f, clock, 500*time.Millisecond,
+		obs("你好", 1), obs("你好", 1), obs("你好", 1), obs("你好", 1), // 1.5s 内重复
+		obs("你好", 1), // 距上次下发 2s
+		obs("谢谢", 1), obs("你好", 1),
+	)
+	want := []string{"你好", "你好", "谢谢", "你好"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("accepted = %v, want %v", got, want)
+	}
+}
+
+func TestConsecutive(t *testing.T) {
+	f := NewConsecutive(3)
+	got := accepted(f, nil, 0,
+		obs("你好", 1), obs("你好", 1), obs("再见", 1), obs("你好", 1), obs("你好", 1), obs("你好", 1), obs("你好", 1),
+		obs("谢谢", 1), obs("谢谢", 1), obs("谢谢", 1),
+	)
+	want := []string{"你好", "谢谢"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("accepted = %v, want %v", got, want)
+	}
+}
+
+func TestConfidenceThreshold(t *testing.T) {
+	got := accepted(ConfidenceThreshold{Min: 0.6}, nil, 0, obs("a", 0.59), obs("b", 0.6), obs("c", 0.9))
+	if want := []string{"b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("accepted = %v, want %v", got, want)
+	}
+}
+
+func TestHysteresis(t *testing.T) {
+	f := NewHysteresis(0.7, 0.4)
+	got := accepted(f, nil, 0,
+		obs("你好", 0.5),  // 未达到 enter
+		obs("你好", 0.8),  // 激活
+		obs("你好", 0.5),  // 高于 exit，保持
+		obs("你好", 0.75), // 仍处于激活状态，不重复下发
+		obs("你好", 0.3),  // 低于 exit，解除
+		obs("你好", 0.6),  // 未达到 enter
+		obs("你好", 0.7),  // 重新激活
+		obs("谢谢", 0.65), // 其他结果未达到 enter
+		obs("谢谢", 0.9),
+	)
+	want := []string{"你好", "你好", "谢谢"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("accepted = %v, want %v", got, want)
+	}
+}
+
+func TestParseFilters(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	cfgs, err := ParseFilters("confidence:0.5, consecutive:2, dedup:1s")
+	if err != nil {
+		t.Fatalf("ParseFilters failed: %v", err)
+	}
+	chain := NewFilter(cfgs, clock.Now)
+	if len(chain) != 3 {
+		t.Fatalf("len(chain) = %d, want 3", len(chain))
+	}
+	// 低置信度的帧不参与连续计数
+	got := accepted(chain, clock, 100*time.Millisecond,
+		obs("你好", 0.9), obs("你好", 0.1), obs("你好", 0.9),
+		obs("", 1), obs("", 1), obs("你好", 0.9), obs("你好", 0.9),
+	)
+	want := []string{"你好", "", "你好"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("accepted = %v, want %v", got, want)
+	}
+
+	cfgs, err = ParseFilters("hysteresis:0.7/0.4")
+	if want := []config.FilterConfig{{Type: "hysteresis", Enter: 0.7, Exit: 0.4}}; err != nil || !reflect.DeepEqual(cfgs, want) {
+		t.Fatalf("ParseFilters(hysteresis) = %+v, %v", cfgs, err)
+	}
+	for _, spec := range []string{"dedup", "dedup:1h", "consecutive:0", "confidence:2", "hysteresis:0.4/0.7", "hysteresis:0.7", "median:3"} {
+		if _, err := ParseFilters(spec); err == nil {
+			t.Errorf("ParseFilters(%q) succeeded, want error", spec)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package recording
+
+import (
+	"github.com/pion/rtp/codecs"
+)
+
+var annexBStartCode = []byte{0, 0, 0, 1}
+
+// h265Depacketizer 将 H.265 RTP 负载（RFC 7798）转换为 Annex-B 数据，
+// codecs.H265Packet 只解析结构而不输出 NAL 数据
+type h265Depacketizer struct {
+	codecs.H265Packet
+}
+
+func (d *h265Depacketizer) Unmarshal(payload []byte) ([]byte, error) {
+	if _, err := d.H265Packet.Unmarshal(payload); err != nil {
+		return nil, err
+	}
+	var out []byte
+	switch p := d.Packet().(type) {
+	case *codecs.H265SingleNALUnitPacket:
+		header := p.PayloadHeader()
+		out = append(out, annexBStartCode...)
+		out = append(out, byte(header>>8), byte(header))
+		out = append(out, p.Payload()...)
+	case *codecs.H265AggregationPacket:
+		if first := p.FirstUnit(); first != nil {
+			out = append(out, annexBStartCode...)
+			out = append(out, first.NalUnit()...)
+		}
+		for _, unit := range p.OtherUnits() {
+			out = append(out, annexBStartCode...)
+			out = append(out, unit.NalUnit()...)
+		}
+	case *codecs.H265FragmentationUnitPacket:
+		fu := p.FuHeader()
+		if fu.S() {
+			// 用负载头的 F、LayerID、TID 与 FU 头中的类型重建 NAL 头
+			header := p.PayloadHeader()
+			out = append(out, annexBStartCode...)
+			out = append(out, byte(header>>8)&0x81|fu.FuType()<<1, byte(header))
+		}
+		out = append(out, p.Payload()...)
+	}
+	return out, nil
+}
@@ -0,0 +1,47 @@
+package recording
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// ivfWriter 写入 IVF 容器，pion 的 ivfwriter 不支持 VP9，因此自行实现
+type ivfWriter struct {
+	w     io.Writer
+	count uint32
+}
+
+func newIVFWriter(w io.Writer, fourCC string, clockRate uint32) (*ivfWriter, error) {
+	header := make([]byte, 32)
+	copy(header[0:], "DKIF")
+	binary.LittleEndian.PutUint16(header[4:], 0)  // 版本
+	binary.LittleEndian.PutUint16(header[6:], 32) // 头长度
+	copy(header[8:], fourCC)
+	// 宽高由码流自身决定，这里留空
+	binary.LittleEndian.PutUint32(header[16:], clockRate) // 时间基分母
+	binary.LittleEndian.PutUint32(header[20:], 1)         // 时间基分子
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &ivfWriter{w: w}, nil
+}
+
+func (i *ivfWriter) writeFrame(frame []byte, pts uint64) error {
+	header := make([]byte, 12)
+	binary.LittleEndian.PutUint32(header[0:], uint32(len(frame)))
+	binary.LittleEndian.PutUint64(header[4:], pts)
+	if _, err := i.w.Write(header); err != nil {
+		return err
+	}
+	i.count++
+	_, err := i.w.Write(frame)
+	return err
+}
+
+// finalize 在文件头中写入帧数
+func (i *ivfWriter) finalize(w io.WriterAt) error {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, i.count)
+	_, err := w.WriteAt(buf, 24)
+	return err
+}
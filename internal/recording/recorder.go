@@ -0,0 +1,110 @@
+// Package recording 将会话中收到的 RTP 音视频写入磁盘，并把识别结果写为 WebVTT 字幕
+package recording
+
+import (
+	"errors"
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/fileutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionRecorder 一个会话的录制，文件位于 <dir>/<session_id>/ 下
+type SessionRecorder struct {
+	cfg    config.RecordingConfig
+	dir    string
+	start  time.Time
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	vtt    *vttWriter
+	closed bool
+}
+
+func NewSessionRecorder(cfg config.RecordingConfig, sessionID string, logger *slog.Logger) (*SessionRecorder, error) {
+	dir := filepath.Join(cfg.Dir, fileutil.SanitizeName(sessionID))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating recording directory: %w", err)
+	}
+	r := &SessionRecorder{cfg: cfg, dir: dir, start: time.Now(), logger: logger}
+	if cfg.Results {
+		vtt, err := newVTTWriter(filepath.Join(dir, "results.vtt"), r.start)
+		if err != nil {
+			return nil, err
+		}
+		r.vtt = vtt
+	}
+	logger.Info("recording session", "dir", dir)
+	return r, nil
+}
+
+// Dir 返回会话的录制目录
+func (r *SessionRecorder) Dir() string {
+	return r.dir
+}
+
+// TrackInfo 创建 TrackRecorder 所需的轨道信息
+type TrackInfo struct {
+	ID        string
+	MimeType  string
+	ClockRate uint32
+	Channels  uint16
+	// RequestKeyFrame 切分文件时请求发送端尽快发送关键帧，可为空
+	RequestKeyFrame func()
+}
+
+// NewTrack 为一个轨道创建录制，不支持的编码或未开启音频录制时返回 ErrSkipped
+func (r *SessionRecorder) NewTrack(info TrackInfo) (*TrackRecorder, error) {
+	format, ok := formats[strings.ToLower(info.MimeType)]
+	if !ok {
+		return nil, fmt.Errorf("%w: codec %s not supported", ErrSkipped, info.MimeType)
+	}
+	if format.audio && !r.cfg.Audio {
+		return nil, fmt.Errorf("%w: audio recording disabled", ErrSkipped)
+	}
+	t := &TrackRecorder{
+		info:        info,
+		format:      format,
+		base:        filepath.Join(r.dir, fileutil.SanitizeName(info.ID)),
+		maxSize:     r.cfg.MaxFileSize,
+		maxDuration: r.cfg.MaxFileDuration,
+		logger:      r.logger.With("track_id", info.ID),
+	}
+	if !format.audio {
+		t.builder = format.newBuilder(info.ClockRate)
+	}
+	return t, nil
+}
+
+// ErrSkipped 轨道不会被录制
+var ErrSkipped = errors.New("track not recorded")
+
+// WriteResult 记录一条识别结果，时间为相对会话开始的偏移
+func (r *SessionRecorder) WriteResult(text string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.vtt == nil || r.closed {
+		return
+	}
+	if err := r.vtt.write(text, time.Now()); err != nil {
+		r.logger.Warn("failed to write recognition result", "error", err)
+	}
+}
+
+func (r *SessionRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if r.vtt != nil {
+		return r.vtt.close(time.Now())
+	}
+	return nil
+}
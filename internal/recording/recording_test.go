@@ -0,0 +1,186 @@
+package recording
+
+import (
+	"bytes"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/keyframe"
+	"github.com/haowei703/webrtc-server/internal/synthetic"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func newTestRecorder(t *testing.T, cfg config.RecordingConfig) *SessionRecorder {
+	t.Helper()
+	cfg.Dir = t.TempDir()
+	r, err := NewSessionRecorder(cfg, "session/1", testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// writeVP8 将 frames 打包为 RTP 后写入录制
+func writeVP8(t *testing.T, track *TrackRecorder, frames [][]byte) {
+	t.Helper()
+	packetizer := rtp.NewPacketizer(1200, 96, 1, &codecs.VP8Payloader{}, rtp.NewFixedSequencer(1), 90000)
+	for _, frame := range frames {
+		for _, packet := range packetizer.Packetize(frame, 3000) {
+			if err := track.WriteRTP(packet); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func readIVF(t *testing.T, path string) (string, [][]byte) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	reader, header, err := ivfreader.NewWith(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frames [][]byte
+	for {
+		frame, _, err := reader.ParseNextFrame()
+		if err == io.EOF {
+			return header.FourCC, frames
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, frame)
+	}
+}
+
+func TestRecordVP8(t *testing.T) {
+	r := newTestRecorder(t, config.RecordingConfig{})
+	keyFrame := synthetic.VP8KeyFrame(64, 48)
+	interFrame := append([]byte{keyFrame[0] | 1}, keyFrame[1:]...)
+
+	requested := 0
+	track, err := r.NewTrack(TrackInfo{ID: "video", MimeType: "video/VP8", ClockRate: 90000, RequestKeyFrame: func() { requested++ }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 第一个关键帧之前的帧被丢弃，并请求关键帧
+	writeVP8(t, track, [][]byte{interFrame, interFrame, keyFrame, interFrame, interFrame, keyFrame})
+	if err := track.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if requested != 1 {
+		t.Errorf("key frame requested %d times, want 1", requested)
+	}
+
+	fourCC, frames := readIVF(t, filepath.Join(r.Dir(), "video_000.ivf"))
+	if fourCC != "VP80" {
+		t.Errorf("FourCC = %q", fourCC)
+	}
+	// 最后一帧要等到下一个包到达才能确定结束，关闭时被丢弃
+	if len(frames) != 3 {
+		t.Fatalf("recorded %d frames, want 3", len(frames))
+	}
+	if !bytes.Equal(frames[0], keyFrame) || !bytes.Equal(frames[1], interFrame) {
+		t.Error("recorded frames differ from input")
+	}
+}
+
+func TestRecordRotatesAtKeyFrame(t *testing.T) {
+	keyFrame := synthetic.VP8KeyFrame(64, 48)
+	interFrame := append([]byte{keyFrame[0] | 1}, keyFrame[1:]...)
+	r := newTestRecorder(t, config.RecordingConfig{MaxFileSize: int64(len(keyFrame))})
+
+	track, err := r.NewTrack(TrackInfo{ID: "video", MimeType: "video/VP8", ClockRate: 90000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeVP8(t, track, [][]byte{keyFrame, interFrame, interFrame, keyFrame, interFrame, keyFrame})
+	if err := track.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []int{3, 2} {
+		_, frames := readIVF(t, filepath.Join(r.Dir(), []string{"video_000.ivf", "video_001.ivf"}[i]))
+		if len(frames) != want {
+			t.Errorf("file %d has %d frames, want %d", i, len(frames), want)
+		}
+		if len(frames) > 0 && !keyframe.VP8(frames[0]) {
+			t.Errorf("file %d does not start with a key frame", i)
+		}
+	}
+}
+
+func TestNewTrackSkipsAudioWhenDisabled(t *testing.T) {
+	r := newTestRecorder(t, config.RecordingConfig{Audio: false})
+	if _, err := r.NewTrack(TrackInfo{ID: "audio", MimeType: "audio/opus", ClockRate: 48000}); err == nil {
+		t.Fatal("expected audio track to be skipped")
+	}
+	if _, err := r.NewTrack(TrackInfo{ID: "video", MimeType: "video/AV1"}); err == nil {
+		t.Fatal("expected unsupported codec to be skipped")
+	}
+}
+
+func TestWebVTTResults(t *testing.T) {
+	r := newTestRecorder(t, config.RecordingConfig{Results: true})
+	r.WriteResult("你好")
+	r.WriteResult("<谢谢>")
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(r.Dir(), "results.vtt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cue := regexp.MustCompile(`(?m)^(\d+)\n\d{2}:\d{2}:\d{2}\.\d{3} --> \d{2}:\d{2}:\d{2}\.\d{3}\n(.+)$`)
+	matches := cue.FindAllStringSubmatch(string(data), -1)
+	if !bytes.HasPrefix(data, []byte("WEBVTT")) || len(matches) != 2 {
+		t.Fatalf("unexpected WebVTT output:\n%s", data)
+	}
+	if matches[0][2] != "你好" || matches[1][2] != "&lt;谢谢&gt;" {
+		t.Errorf("cues = %q, %q", matches[0][2], matches[1][2])
+	}
+}
+
+func TestVTTTimestamp(t *testing.T) {
+	if got := vttTimestamp(time.Hour + 2*time.Minute + 3*time.Second + 45*time.Millisecond); got != "01:02:03.045" {
+		t.Errorf("vttTimestamp = %s", got)
+	}
+}
+
+func TestH265Depacketizer(t *testing.T) {
+	// IDR_W_RADL（类型 19）的 NAL 拆分为两个 FU
+	nal := []byte{19 << 1, 0x01, 0xaa, 0xbb, 0xcc, 0xdd}
+	fuHeader := []byte{49 << 1, 0x01}
+	start := append(append([]byte{}, fuHeader...), 0x80|19, 0xaa, 0xbb)
+	end := append(append([]byte{}, fuHeader...), 0x40|19, 0xcc, 0xdd)
+
+	d := &h265Depacketizer{}
+	var out []byte
+	for _, payload := range [][]byte{start, end} {
+		data, err := d.Unmarshal(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, data...)
+	}
+	want := append(append([]byte{}, annexBStartCode...), nal...)
+	if !bytes.Equal(out, want) {
+		t.Fatalf("got %x, want %x", out, want)
+	}
+	if !keyframe.H265(out) {
+		t.Error("IDR not detected as key frame")
+	}
+}
@@ -0,0 +1,255 @@
+package recording
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/keyframe"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+	"github.com/pion/webrtc/v3/pkg/media/samplebuilder"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// maxLatePackets 组帧时等待乱序包的最大包数
+const maxLatePackets = 256
+
+// format 一种编码对应的容器格式
+type format struct {
+	ext        string
+	audio      bool
+	newBuilder func(clockRate uint32) *samplebuilder.SampleBuilder
+	// open 在 w 上创建容器，视频返回 frameWriter，音频返回 rtpWriter
+	open     func(w io.Writer, info TrackInfo) (any, error)
+	keyFrame func(frame []byte) bool
+}
+
+type frameWriter interface {
+	writeFrame(frame []byte, pts uint64) error
+}
+
+type rtpWriter interface {
+	WriteRTP(packet *rtp.Packet) error
+}
+
+var formats = map[string]format{
+	"video/vp8": {
+		ext:        "ivf",
+		newBuilder: videoBuilder(func() rtp.Depacketizer { return &codecs.VP8Packet{} }),
+		open:       openIVF("VP80"),
+		keyFrame:   keyframe.VP8,
+	},
+	"video/vp9": {
+		ext:        "ivf",
+		newBuilder: videoBuilder(func() rtp.Depacketizer { return &codecs.VP9Packet{} }),
+		open:       openIVF("VP90"),
+		keyFrame:   keyframe.VP9,
+	},
+	"video/h264": {
+		ext:        "h264",
+		newBuilder: videoBuilder(func() rtp.Depacketizer { return &codecs.H264Packet{} }),
+		open:       openAnnexB,
+		keyFrame:   keyframe.H264,
+	},
+	"video/h265": {
+		ext:        "h265",
+		newBuilder: videoBuilder(func() rtp.Depacketizer { return &h265Depacketizer{} }),
+		open:       openAnnexB,
+		keyFrame:   keyframe.H265,
+	},
+	"audio/opus": {
+		ext:   "ogg",
+		audio: true,
+		open: func(w io.Writer, info TrackInfo) (any, error) {
+			return oggwriter.NewWith(w, info.ClockRate, max(info.Channels, 1))
+		},
+	},
+}
+
+func videoBuilder(depacketizer func() rtp.Depacketizer) func(uint32) *samplebuilder.SampleBuilder {
+	return func(clockRate uint32) *samplebuilder.SampleBuilder {
+		return samplebuilder.New(maxLatePackets, depacketizer(), clockRate)
+	}
+}
+
+func openIVF(fourCC string) func(io.Writer, TrackInfo) (any, error) {
+	return func(w io.Writer, info TrackInfo) (any, error) {
+		return newIVFWriter(w, fourCC, info.ClockRate)
+	}
+}
+
+func openAnnexB(w io.Writer, _ TrackInfo) (any, error) {
+	return annexBWriter{w}, nil
+}
+
+// annexBWriter H.264/H.265 组帧结果已带起始码，直接写入
+type annexBWriter struct {
+	w io.Writer
+}
+
+func (a annexBWriter) writeFrame(frame []byte, _ uint64) error {
+	_, err := a.w.Write(frame)
+	return err
+}
+
+// TrackRecorder 录制一个轨道，超过大小或时长上限时切分为新文件：<track>_000.<ext>、<track>_001.<ext>...
+// WriteRTP 不会被并发调用
+type TrackRecorder struct {
+	info        TrackInfo
+	format      format
+	base        string
+	maxSize     int64
+	maxDuration time.Duration
+	logger      *slog.Logger
+	builder     *samplebuilder.SampleBuilder
+
+	file      *os.File
+	buf       *bufio.Writer
+	counter   *countingWriter
+	writer    any
+	index     int
+	opened    time.Time
+	firstTS   uint32
+	pts       uint64
+	rotating  bool // 等待关键帧以切分文件
+	requested bool // 已为当前文件请求过关键帧
+}
+
+// WriteRTP 写入一个 RTP 包，视频在收到第一个关键帧之前的数据会被丢弃
+func (t *TrackRecorder) WriteRTP(packet *rtp.Packet) error {
+	if t.format.audio {
+		return t.writeAudio(packet)
+	}
+	t.builder.Push(packet)
+	for {
+		sample, ts := t.builder.PopWithTimestamp()
+		if sample == nil {
+			return nil
+		}
+		if err := t.writeSample(sample, ts); err != nil {
+			return err
+		}
+	}
+}
+
+func (t *TrackRecorder) writeSample(sample *media.Sample, ts uint32) error {
+	keyFrame := t.format.keyFrame(sample.Data)
+	if t.file != nil && t.shouldRotate() {
+		t.rotating = true
+	}
+	switch {
+	case t.file == nil && !keyFrame:
+		t.requestKeyFrame()
+		return nil
+	case t.rotating && keyFrame:
+		if err := t.closeFile(); err != nil {
+			return err
+		}
+	case t.rotating:
+		t.requestKeyFrame()
+	}
+	if t.file == nil {
+		if err := t.openFile(); err != nil {
+			return err
+		}
+		t.firstTS = ts
+	}
+	// 以 RTP 时间戳作为 PTS，时间基为时钟频率
+	t.pts = uint64(ts - t.firstTS)
+	return t.writer.(frameWriter).writeFrame(sample.Data, t.pts)
+}
+
+func (t *TrackRecorder) writeAudio(packet *rtp.Packet) error {
+	if t.file != nil && t.shouldRotate() {
+		if err := t.closeFile(); err != nil {
+			return err
+		}
+	}
+	if t.file == nil {
+		if err := t.openFile(); err != nil {
+			return err
+		}
+	}
+	return t.writer.(rtpWriter).WriteRTP(packet)
+}
+
+func (t *TrackRecorder) shouldRotate() bool {
+	return t.maxSize > 0 && t.counter.n >= t.maxSize ||
+		t.maxDuration > 0 && time.Since(t.opened) >= t.maxDuration
+}
+
+func (t *TrackRecorder) requestKeyFrame() {
+	if t.requested || t.info.RequestKeyFrame == nil {
+		return
+	}
+	t.requested = true
+	t.info.RequestKeyFrame()
+}
+
+func (t *TrackRecorder) openFile() error {
+	path := fmt.Sprintf("%s_%03d.%s", t.base, t.index, t.format.ext)
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating recording: %w", err)
+	}
+	t.file = f
+	t.buf = bufio.NewWriter(f)
+	t.counter = &countingWriter{w: t.buf}
+	writer, err := t.format.open(t.counter, t.info)
+	if err != nil {
+		f.Close()
+		t.file = nil
+		return fmt.Errorf("creating recording: %w", err)
+	}
+	t.writer = writer
+	t.index++
+	t.opened = time.Now()
+	t.rotating = false
+	t.requested = false
+	t.logger.Info("recording file opened", "path", path)
+	return nil
+}
+
+func (t *TrackRecorder) closeFile() error {
+	if t.file == nil {
+		return nil
+	}
+	var err error
+	if c, ok := t.writer.(interface{ Close() error }); ok {
+		// oggwriter 只在直接写入 *os.File 时于 Close 中把最后一页标记为 EOS，
+		// 这里写入的是 countingWriter，Close 只释放其状态，文件中没有 EOS 标志
+		err = c.Close()
+	}
+	if ferr := t.buf.Flush(); err == nil {
+		err = ferr
+	}
+	if ivf, ok := t.writer.(*ivfWriter); ok && err == nil {
+		err = ivf.finalize(t.file)
+	}
+	if cerr := t.file.Close(); err == nil {
+		err = cerr
+	}
+	t.file = nil
+	return err
+}
+
+// Close 关闭当前文件，缓存中尚未组成完整帧的数据会被丢弃
+func (t *TrackRecorder) Close() error {
+	return t.closeFile()
+}
+
+// countingWriter 统计已写入的字节数，用于按大小切分
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,83 @@
+package recording
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxCueDuration 一条识别结果字幕的最长显示时间
+const maxCueDuration = 3 * time.Second
+
+// vttWriter 将识别结果写为 WebVTT，每条结果显示到下一条结果出现或 maxCueDuration 为止
+type vttWriter struct {
+	file    *os.File
+	buf     *bufio.Writer
+	start   time.Time
+	pending string
+	at      time.Time
+	count   int
+}
+
+func newVTTWriter(path string, start time.Time) (*vttWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating WebVTT file: %w", err)
+	}
+	v := &vttWriter{file: f, buf: bufio.NewWriter(f), start: start}
+	fmt.Fprintf(v.buf, "WEBVTT - recognition results\nNOTE session started at %s\n\n", start.UTC().Format(time.RFC3339Nano))
+	return v, nil
+}
+
+func (v *vttWriter) write(text string, at time.Time) error {
+	if err := v.flushCue(at); err != nil {
+		return err
+	}
+	v.pending, v.at = text, at
+	return nil
+}
+
+// flushCue 写出上一条结果，结束时间取 now 与最长显示时间中较早者
+func (v *vttWriter) flushCue(now time.Time) error {
+	if v.pending == "" {
+		return nil
+	}
+	end := v.at.Add(maxCueDuration)
+	if now.Before(end) {
+		end = now
+	}
+	v.count++
+	_, err := fmt.Fprintf(v.buf, "%d\n%s --> %s\n%s\n\n", v.count, vttTimestamp(v.at.Sub(v.start)), vttTimestamp(end.Sub(v.start)), vttEscape(v.pending))
+	v.pending = ""
+	if err != nil {
+		return err
+	}
+	// 及时落盘，进程异常退出时也能保留已有结果
+	return v.buf.Flush()
+}
+
+func (v *vttWriter) close(now time.Time) error {
+	err := v.flushCue(now)
+	if ferr := v.buf.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := v.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// vttTimestamp 格式化为 hh:mm:ss.ttt
+func vttTimestamp(d time.Duration) string {
+	d = max(d, 0)
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// vttEscape WebVTT 文本中 & < > 需要转义，且不允许出现 "-->" 与空行
+func vttEscape(s string) string {
+	s = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+	return strings.Join(strings.Fields(strings.ReplaceAll(s, "\n", " ")), " ")
+}
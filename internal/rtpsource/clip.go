@@ -0,0 +1,68 @@
+package rtpsource
+
+import (
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/mediafile"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v3"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	clipMTU       = 1200
+	clipSSRC      = 1
+	clipClockRate = 90000
+)
+
+// clipSource 将录制的编码帧重新打包为 RTP，序列号与 SSRC 固定，保证输出可复现
+type clipSource struct {
+	clip       *mediafile.Clip
+	packetizer rtp.Packetizer
+	next       int
+	queue      []*rtp.Packet
+	offset     time.Duration
+}
+
+func NewClipSource(clip *mediafile.Clip) (Source, error) {
+	var payloader rtp.Payloader
+	switch strings.ToLower(clip.MimeType) {
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		payloader = &codecs.VP8Payloader{}
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		payloader = &codecs.VP9Payloader{InitialPictureIDFn: func() uint16 { return 0 }}
+	case strings.ToLower(webrtc.MimeTypeH264):
+		payloader = &codecs.H264Payloader{}
+	default:
+		return nil, fmt.Errorf("replaying %s is not supported", clip.MimeType)
+	}
+	return &clipSource{
+		clip:       clip,
+		packetizer: rtp.NewPacketizer(clipMTU, 96, clipSSRC, payloader, rtp.NewFixedSequencer(1), clipClockRate),
+	}, nil
+}
+
+func (s *clipSource) Next() (*rtp.Packet, time.Duration, error) {
+	for len(s.queue) == 0 {
+		if s.next >= len(s.clip.Frames) {
+			return nil, 0, io.EOF
+		}
+		frame := s.clip.Frames[s.next]
+		s.next++
+		s.queue = s.packetizer.Packetize(frame.Data, 0)
+		ts := uint32((frame.Timestamp*clipClockRate + time.Second/2) / time.Second)
+		for _, packet := range s.queue {
+			packet.Timestamp = ts
+		}
+		s.offset = frame.Timestamp
+	}
+	packet := s.queue[0]
+	s.queue = s.queue[1:]
+	return packet, s.offset, nil
+}
+
+func (s *clipSource) Close() error {
+	return nil
+}
@@ -0,0 +1,155 @@
+package rtpsource
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/pion/rtp"
+	"io"
+	"time"
+)
+
+// pcap 链路层类型
+const (
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLinuxSLL = 113
+	linkTypeIPv4     = 228
+	linkTypeIPv6     = 229
+)
+
+// pcapSource 读取 libpcap 格式抓包中 UDP 承载的明文 RTP。
+// WebRTC 的媒体默认经过 SRTP 加密，需要使用未加密或已解密的抓包
+type pcapSource struct {
+	file     io.Closer
+	r        *bufio.Reader
+	order    binary.ByteOrder
+	nano     bool
+	linkType uint32
+	first    time.Time
+}
+
+func newPcapSource(f io.ReadCloser) (*pcapSource, error) {
+	s := &pcapSource{file: f, r: bufio.NewReader(f)}
+	header := make([]byte, 24)
+	if err := readFull(s.r, header); err != nil {
+		return nil, err
+	}
+	switch magic := binary.LittleEndian.Uint32(header); magic {
+	case 0xa1b2c3d4:
+		s.order = binary.LittleEndian
+	case 0xa1b23c4d:
+		s.order, s.nano = binary.LittleEndian, true
+	case 0xd4c3b2a1:
+		s.order = binary.BigEndian
+	case 0x4d3cb2a1:
+		s.order, s.nano = binary.BigEndian, true
+	default:
+		return nil, fmt.Errorf("not a pcap file (magic %#x), pcapng is not supported", magic)
+	}
+	s.linkType = s.order.Uint32(header[20:])
+	switch s.linkType {
+	case linkTypeNull, linkTypeEthernet, linkTypeRaw, linkTypeLinuxSLL, linkTypeIPv4, linkTypeIPv6:
+	default:
+		return nil, fmt.Errorf("pcap link type %d not supported", s.linkType)
+	}
+	return s, nil
+}
+
+func (s *pcapSource) Next() (*rtp.Packet, time.Duration, error) {
+	record := make([]byte, 16)
+	for {
+		if err := readFull(s.r, record); err != nil {
+			return nil, 0, err
+		}
+		sec, frac := s.order.Uint32(record[0:]), s.order.Uint32(record[4:])
+		capLen := s.order.Uint32(record[8:])
+		data := make([]byte, capLen)
+		if err := readFull(s.r, data); err != nil {
+			return nil, 0, err
+		}
+
+		ts := time.Unix(int64(sec), int64(frac)*1000)
+		if s.nano {
+			ts = time.Unix(int64(sec), int64(frac))
+		}
+		payload := s.udpPayload(data)
+		if !isRTP(payload) {
+			continue
+		}
+		packet, err := unmarshalRTP(payload)
+		if err != nil {
+			continue
+		}
+		if s.first.IsZero() {
+			s.first = ts
+		}
+		return packet, ts.Sub(s.first), nil
+	}
+}
+
+// udpPayload 剥离链路层、IP 与 UDP 头，不是 UDP 时返回 nil
+func (s *pcapSource) udpPayload(data []byte) []byte {
+	var etherType uint16
+	switch s.linkType {
+	case linkTypeNull:
+		if len(data) < 4 {
+			return nil
+		}
+		data = data[4:]
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return nil
+		}
+		etherType = binary.BigEndian.Uint16(data[12:])
+		data = data[14:]
+		// 跳过 VLAN 标签
+		for (etherType == 0x8100 || etherType == 0x88a8) && len(data) >= 4 {
+			etherType = binary.BigEndian.Uint16(data[2:])
+			data = data[4:]
+		}
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil
+		}
+		etherType = binary.BigEndian.Uint16(data[14:])
+		data = data[16:]
+	}
+	if etherType != 0 && etherType != 0x0800 && etherType != 0x86dd {
+		return nil
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	switch data[0] >> 4 {
+	case 4:
+		ihl := int(data[0]&0x0f) * 4
+		if len(data) < ihl+8 || data[9] != 17 {
+			return nil
+		}
+		// 分片的 IP 包不做重组
+		if binary.BigEndian.Uint16(data[6:])&0x3fff != 0 {
+			return nil
+		}
+		data = data[ihl:]
+	case 6:
+		// 不处理 IPv6 扩展头
+		if len(data) < 48 || data[6] != 17 {
+			return nil
+		}
+		data = data[40:]
+	default:
+		return nil
+	}
+	length := int(binary.BigEndian.Uint16(data[4:]))
+	if length < 8 || length > len(data) {
+		length = len(data)
+	}
+	return data[8:length]
+}
+
+func (s *pcapSource) Close() error {
+	return s.file.Close()
+}
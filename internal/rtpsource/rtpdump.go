@@ -0,0 +1,43 @@
+package rtpsource
+
+import (
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3/pkg/media/rtpdump"
+	"io"
+	"time"
+)
+
+// rtpDumpSource 读取 rtptools 的 rtpdump 格式
+type rtpDumpSource struct {
+	file   io.Closer
+	reader *rtpdump.Reader
+}
+
+func newRTPDumpSource(f io.ReadCloser) (*rtpDumpSource, error) {
+	reader, _, err := rtpdump.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return &rtpDumpSource{file: f, reader: reader}, nil
+}
+
+func (s *rtpDumpSource) Next() (*rtp.Packet, time.Duration, error) {
+	for {
+		p, err := s.reader.Next()
+		if err != nil {
+			return nil, 0, err
+		}
+		if p.IsRTCP || !isRTP(p.Payload) {
+			continue
+		}
+		packet, err := unmarshalRTP(p.Payload)
+		if err != nil {
+			continue
+		}
+		return packet, p.Offset, nil
+	}
+}
+
+func (s *rtpDumpSource) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,143 @@
+package rtpsource
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/haowei703/webrtc-server/internal/mediafile"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3/pkg/media/rtpdump"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func rtpBytes(t *testing.T, ssrc uint32, seq uint16, pt uint8) []byte {
+	t.Helper()
+	data, err := (&rtp.Packet{
+		Header:  rtp.Header{Version: 2, PayloadType: pt, SequenceNumber: seq, SSRC: ssrc},
+		Payload: []byte{0x10, 0x01, 0x02},
+	}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// ethernetUDP 构造以太网 + IPv4 + UDP 帧
+func ethernetUDP(payload []byte) []byte {
+	frame := make([]byte, 14+20+8)
+	binary.BigEndian.PutUint16(frame[12:], 0x0800)
+	ip := frame[14:]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+8+len(payload)))
+	ip[9] = 17
+	udp := ip[20:]
+	binary.BigEndian.PutUint16(udp[4:], uint16(8+len(payload)))
+	return append(frame, payload...)
+}
+
+func readAll(t *testing.T, src Source) ([]*rtp.Packet, []time.Duration) {
+	t.Helper()
+	var packets []*rtp.Packet
+	var offsets []time.Duration
+	for {
+		packet, offset, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			return packets, offsets
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, packet)
+		offsets = append(offsets, offset)
+	}
+}
+
+func TestPcapSource(t *testing.T) {
+	var buf bytes.Buffer
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header, 0xa1b2c3d4)
+	binary.LittleEndian.PutUint32(header[20:], linkTypeEthernet)
+	buf.Write(header)
+	records := [][]byte{
+		ethernetUDP(rtpBytes(t, 1, 10, 96)),
+		ethernetUDP([]byte{0x00, 0x01, 0x00, 0x00}),                  // STUN
+		ethernetUDP([]byte{0x80, 200, 0, 6, 0, 0, 0, 1, 0, 0, 0, 0}), // RTCP SR
+		ethernetUDP(rtpBytes(t, 1, 11, 96)),
+	}
+	for i, data := range records {
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record[0:], 100)
+		binary.LittleEndian.PutUint32(record[4:], uint32(i*20000))
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(data)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(data)))
+		buf.Write(record)
+		buf.Write(data)
+	}
+
+	src, err := newPcapSource(io.NopCloser(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets, offsets := readAll(t, src)
+	if len(packets) != 2 || packets[1].SequenceNumber != 11 {
+		t.Fatalf("got %d packets: %v", len(packets), packets)
+	}
+	if offsets[1] != 60*time.Millisecond {
+		t.Errorf("offset = %v, want 60ms", offsets[1])
+	}
+	if !bytes.Equal(packets[0].Payload, []byte{0x10, 0x01, 0x02}) {
+		t.Errorf("payload = %x", packets[0].Payload)
+	}
+}
+
+func TestRTPDumpSourceWithFilter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := rtpdump.NewWriter(&buf, rtpdump.Header{Start: time.Unix(0, 0), Source: net.IPv4(127, 0, 0, 1), Port: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range [][]byte{rtpBytes(t, 2, 1, 111), rtpBytes(t, 1, 1, 96), rtpBytes(t, 3, 1, 96), rtpBytes(t, 1, 2, 96)} {
+		if err := w.WritePacket(rtpdump.Packet{Offset: time.Duration(i) * time.Millisecond, Payload: p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	src, err := newRTPDumpSource(io.NopCloser(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets, offsets := readAll(t, &Filter{Source: src, PayloadType: 96})
+	if len(packets) != 2 || packets[0].SSRC != 1 || packets[1].SequenceNumber != 2 {
+		t.Fatalf("unexpected packets: %v", packets)
+	}
+	if offsets[1] != 3*time.Millisecond {
+		t.Errorf("offset = %v", offsets[1])
+	}
+}
+
+func TestClipSource(t *testing.T) {
+	frame := make([]byte, 3000)
+	clip := &mediafile.Clip{MimeType: "video/VP8", Frames: []mediafile.Frame{
+		{Data: frame},
+		{Data: frame, Timestamp: time.Second / 30},
+	}}
+	src, err := NewClipSource(clip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets, offsets := readAll(t, src)
+	if len(packets) != 6 {
+		t.Fatalf("got %d packets, want 6", len(packets))
+	}
+	for i, packet := range packets {
+		if packet.SequenceNumber != uint16(1+i) {
+			t.Errorf("packet %d sequence = %d", i, packet.SequenceNumber)
+		}
+	}
+	if packets[3].Timestamp != 3000 || offsets[3] != time.Second/30 || !packets[2].Marker {
+		t.Errorf("unexpected second frame packet: %v offset %v", packets[3], offsets[3])
+	}
+}
@@ -0,0 +1,337 @@
+// Package signalclient 实现信令协议的客户端一侧，供端到端测试与压测工具模拟浏览器
+package signalclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
+	"net/http"
+	"sync"
+)
+
+// Message 信令消息，与服务端的消息格式一致
+type Message struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type Options struct {
+	ICEServers []webrtc.ICEServer
+	// Dialer 为空时使用 websocket.DefaultDialer，可用于配置 TLS
+	Dialer *websocket.Dialer
+	Header http.Header
+	// DataChannel 非空时在 offer 中创建该标签的 DataChannel，服务端改由其下发识别结果
+	DataChannel string
+}
+
+// Client 通过 WebSocket 信令与服务端建立 PeerConnection
+type Client struct {
+	conn     *websocket.Conn
+	pc       *webrtc.PeerConnection
+	writeMu  sync.Mutex
+	messages chan Message
+	// msgMu 保护 messages 的关闭，DataChannel 与 WebSocket 都会写入
+	msgMu     sync.Mutex
+	msgClosed bool
+	dcOpen    chan struct{}
+	answered  chan struct{}
+	done      chan struct{}
+
+	mu                sync.Mutex
+	offerSent         bool
+	pendingLocal      []webrtc.ICECandidateInit
+	remoteDescSet     bool
+	pendingRemote     []webrtc.ICECandidateInit
+	connected         chan struct{}
+	connectedOnce     sync.Once
+	closeOnce         sync.Once
+	answerOnce        sync.Once
+	connectionFailure error
+}
+
+// Dial 连接信令服务并创建 PeerConnection，之后需调用 AddVideoTrack 与 Negotiate
+func Dial(ctx context.Context, url string, opts Options) (*Client, error) {
+	dialer := opts.Dialer
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	conn, resp, err := dialer.DialContext(ctx, url, opts.Header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("dial %s: %w (status %s)", url, err, resp.Status)
+		}
+		return nil, fmt.Errorf("dial %s: %w", url, err)
+	}
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{ICEServers: opts.ICEServers})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c := &Client{
+		conn:      conn,
+		pc:        pc,
+		messages:  make(chan Message, 64),
+		dcOpen:    make(chan struct{}),
+		answered:  make(chan struct{}),
+		done:      make(chan struct{}),
+		connected: make(chan struct{}),
+	}
+
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+		init := candidate.ToJSON()
+		c.mu.Lock()
+		if !c.offerSent {
+			// offer 发出前产生的候选者先缓存，保证服务端先收到 offer
+			c.pendingLocal = append(c.pendingLocal, init)
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+		_ = c.send("candidate", init)
+	})
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		switch state {
+		case webrtc.PeerConnectionStateConnected:
+			c.connectedOnce.Do(func() { close(c.connected) })
+		case webrtc.PeerConnectionStateFailed:
+			c.mu.Lock()
+			c.connectionFailure = errors.New("peer connection failed")
+			c.mu.Unlock()
+		}
+	})
+
+	if opts.DataChannel != "" {
+		dc, err := pc.CreateDataChannel(opts.DataChannel, nil)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		dc.OnOpen(func() { close(c.dcOpen) })
+		dc.OnMessage(func(m webrtc.DataChannelMessage) {
+			var msg Message
+			if err := json.Unmarshal(m.Data, &msg); err == nil {
+				c.deliver(msg)
+			}
+		})
+	}
+
+	go c.readLoop()
+	return c, nil
+}
+
+// WaitDataChannel 等待 Options.DataChannel 指定的 DataChannel 打开
+func (c *Client) WaitDataChannel(ctx context.Context) error {
+	select {
+	case <-c.dcOpen:
+		return nil
+	case <-c.done:
+		return errors.New("signaling connection closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PeerConnection 返回底层 PeerConnection
+func (c *Client) PeerConnection() *webrtc.PeerConnection {
+	return c.pc
+}
+
+// AddVideoTrack 添加一个用于发送的视频轨道
+func (c *Client) AddVideoTrack(mimeType string) (*webrtc.TrackLocalStaticSample, error) {
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: mimeType}, "video", "signalclient")
+	if err != nil {
+		return nil, err
+	}
+	sender, err := c.pc.AddTrack(track)
+	if err != nil {
+		return nil, err
+	}
+	// 读取 RTCP 以驱动 interceptor
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := sender.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	return track, nil
+}
+
+// Negotiate 发送 offer 并等待 answer
+func (c *Client) Negotiate(ctx context.Context) error {
+	offer, err := c.pc.CreateOffer(nil)
+	if err != nil {
+		return err
+	}
+	if err := c.pc.SetLocalDescription(offer); err != nil {
+		return err
+	}
+	if err := c.send("offer", offer); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.offerSent = true
+	pending := c.pendingLocal
+	c.pendingLocal = nil
+	c.mu.Unlock()
+	for _, candidate := range pending {
+		if err := c.send("candidate", candidate); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case <-c.answered:
+		return nil
+	case <-c.done:
+		return errors.New("signaling connection closed before answer")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WaitConnected 等待 PeerConnection 建立
+func (c *Client) WaitConnected(ctx context.Context) error {
+	select {
+	case <-c.connected:
+		return nil
+	case <-c.done:
+		return errors.New("signaling connection closed")
+	case <-ctx.Done():
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.connectionFailure != nil {
+			return c.connectionFailure
+		}
+		return ctx.Err()
+	}
+}
+
+// Messages 返回 answer、offer 与 candidate 以外的信令消息，例如识别结果 text，
+// 包括经 DataChannel 收到的消息，信令断开后关闭
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+// Send 发送任意信令消息
+func (c *Client) Send(msgType string, data any) error {
+	return c.send(msgType, data)
+}
+
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = errors.Join(c.pc.Close(), c.conn.Close())
+	})
+	return err
+}
+
+func (c *Client) send(msgType string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	msg, err := json.Marshal(Message{Type: msgType, Data: raw})
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteMessage(websocket.TextMessage, msg)
+}
+
+// deliver 将消息交给 Messages，信令断开后丢弃
+func (c *Client) deliver(msg Message) {
+	c.msgMu.Lock()
+	defer c.msgMu.Unlock()
+	if !c.msgClosed {
+		c.messages <- msg
+	}
+}
+
+func (c *Client) readLoop() {
+	defer close(c.done)
+	defer func() {
+		c.msgMu.Lock()
+		c.msgClosed = true
+		close(c.messages)
+		c.msgMu.Unlock()
+	}()
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		switch msg.Type {
+		case "answer":
+			var answer webrtc.SessionDescription
+			if err := json.Unmarshal(msg.Data, &answer); err != nil {
+				continue
+			}
+			if err := c.pc.SetRemoteDescription(answer); err != nil {
+				continue
+			}
+			c.mu.Lock()
+			c.remoteDescSet = true
+			pending := c.pendingRemote
+			c.pendingRemote = nil
+			c.mu.Unlock()
+			for _, candidate := range pending {
+				_ = c.pc.AddICECandidate(candidate)
+			}
+			c.answerOnce.Do(func() { close(c.answered) })
+		case "offer":
+			// 服务端在 ICE 断开后发起的 ICE restart
+			var offer webrtc.SessionDescription
+			if err := json.Unmarshal(msg.Data, &offer); err != nil {
+				continue
+			}
+			if err := c.answerOffer(offer); err != nil {
+				continue
+			}
+		case "candidate":
+			var candidate webrtc.ICECandidateInit
+			if err := json.Unmarshal(msg.Data, &candidate); err != nil {
+				continue
+			}
+			c.mu.Lock()
+			if !c.remoteDescSet {
+				c.pendingRemote = append(c.pendingRemote, candidate)
+				c.mu.Unlock()
+				continue
+			}
+			c.mu.Unlock()
+			_ = c.pc.AddICECandidate(candidate)
+		default:
+			c.deliver(msg)
+		}
+	}
+}
+
+func (c *Client) answerOffer(offer webrtc.SessionDescription) error {
+	if err := c.pc.SetRemoteDescription(offer); err != nil {
+		return err
+	}
+	answer, err := c.pc.CreateAnswer(nil)
+	if err != nil {
+		return err
+	}
+	if err := c.pc.SetLocalDescription(answer); err != nil {
+		return err
+	}
+	return c.send("answer", answer)
+}
@@ -0,0 +1,30 @@
+package synthetic
+
+import (
+	"bytes"
+	"golang.org/x/image/vp8"
+	"testing"
+)
+
+func TestVP8KeyFrameDecodes(t *testing.T) {
+	for _, size := range [][2]int{{16, 16}, {64, 48}, {320, 240}, {33, 17}} {
+		frame := VP8KeyFrame(size[0], size[1])
+
+		d := vp8.NewDecoder()
+		d.Init(bytes.NewReader(frame), len(frame))
+		header, err := d.DecodeFrameHeader()
+		if err != nil {
+			t.Fatalf("%dx%d: DecodeFrameHeader failed: %v", size[0], size[1], err)
+		}
+		if !header.KeyFrame || header.Width != size[0] || header.Height != size[1] {
+			t.Fatalf("%dx%d: unexpected header %+v", size[0], size[1], header)
+		}
+		img, err := d.DecodeFrame()
+		if err != nil {
+			t.Fatalf("%dx%d: DecodeFrame failed: %v", size[0], size[1], err)
+		}
+		if y := img.Y[0]; y != 128 {
+			t.Fatalf("%dx%d: expected mid gray, got luma %d", size[0], size[1], y)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSigned 生成自签名证书并写入文件
+func writeSelfSigned(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeSelfSigned(t, certFile, keyFile, "first")
+
+	r, err := NewCertReloader(certFile, keyFile, slog.Default())
+	if err != nil {
+		t.Fatalf("NewCertReloader failed: %v", err)
+	}
+	cert, _ := r.GetCertificate(nil)
+	if name := commonName(t, cert); name != "first" {
+		t.Fatalf("unexpected certificate %s", name)
+	}
+
+	writeSelfSigned(t, certFile, keyFile, "second")
+	later := time.Now().Add(time.Second)
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	cert, _ = r.GetCertificate(nil)
+	if name := commonName(t, cert); name != "second" {
+		t.Fatalf("certificate not reloaded, got %s", name)
+	}
+
+	// 写入损坏的证书时保留旧证书
+	if err := os.WriteFile(certFile, []byte("broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later = later.Add(time.Second)
+	if err := os.Chtimes(certFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatal("expected error for broken certificate")
+	}
+	cert, _ = r.GetCertificate(nil)
+	if name := commonName(t, cert); name != "second" {
+		t.Fatalf("old certificate not kept, got %s", name)
+	}
+}
+
+func TestParseClientAuth(t *testing.T) {
+	if mode, err := ParseClientAuth("verify_if_given"); err != nil || mode != tls.VerifyClientCertIfGiven {
+		t.Fatalf("unexpected result %v, %v", mode, err)
+	}
+	if _, err := ParseClientAuth("always"); err == nil {
+		t.Fatal("expected error for unknown mode")
+	}
+}
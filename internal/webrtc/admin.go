@@ -0,0 +1,31 @@
+package webrtc
+
+import (
+	"crypto/subtle"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// requireAdmin 只放行携带 admin token 或允许的客户端证书的请求
+func requireAdmin(cfg config.AdminConfig, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !adminAuthorized(cfg, r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func adminAuthorized(cfg config.AdminConfig, r *http.Request) bool {
+	if cfg.Token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) == 1 {
+			return true
+		}
+	}
+	name := clientCertName(r)
+	return name != "" && slices.Contains(cfg.ClientCerts, name)
+}
@@ -0,0 +1,48 @@
+package webrtc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	cfg := config.AdminConfig{Token: "s3cret", ClientCerts: []string{"ops"}}
+	ok := func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	withCert := func(name string) func(*http.Request) {
+		return func(r *http.Request) {
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: name}}
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+	}
+	tests := []struct {
+		name  string
+		cfg   config.AdminConfig
+		setup func(*http.Request)
+		want  int
+	}{
+		{"no credentials", cfg, func(*http.Request) {}, http.StatusForbidden},
+		{"token", cfg, func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusOK},
+		{"wrong token", cfg, func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") }, http.StatusForbidden},
+		{"allowed cert", cfg, withCert("ops"), http.StatusOK},
+		{"other cert", cfg, withCert("client"), http.StatusForbidden},
+		{"not configured", config.AdminConfig{}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer ") }, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/capacity", nil)
+			tt.setup(req)
+			rec := httptest.NewRecorder()
+			requireAdmin(tt.cfg, ok)(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package webrtc
+
+import (
+	"github.com/haowei703/webrtc-server/internal/bitrate"
+	"github.com/haowei703/webrtc-server/internal/capacity"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateController 按识别所需与节点负载定期向客户端发送 REMB，限制其上行码率；
+// 每个 PeerConnection 一个实例，同时作为自身的 interceptor.Factory
+type rateController struct {
+	interceptor.NoOp
+	policy   *bitrate.Policy
+	capacity *capacity.Model
+	control  *SessionControl
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu     sync.Mutex
+	writer interceptor.RTCPWriter
+	// streams 客户端的视频流，值为该流是否因解码容量不足而降级
+	streams map[uint32]bool
+	// sent 各视频流最近一次下发的上限，仅用于记录变化
+	sent      map[uint32]int
+	started   bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *SignalingServer) newRateController(control *SessionControl, logger *slog.Logger) *rateController {
+	return &rateController{
+		policy:   s.bitrate,
+		capacity: s.capacity,
+		control:  control,
+		interval: s.cfg.Bitrate.Interval,
+		logger:   logger,
+		streams:  make(map[uint32]bool),
+		sent:     make(map[uint32]int),
+		done:     make(chan struct{}),
+	}
+}
+
+func (rc *rateController) NewInterceptor(string) (interceptor.Interceptor, error) {
+	return rc, nil
+}
+
+func (rc *rateController) BindRTCPWriter(writer interceptor.RTCPWriter) interceptor.RTCPWriter {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.writer = writer
+	if !rc.started {
+		rc.started = true
+		go rc.run()
+	}
+	return writer
+}
+
+func (rc *rateController) BindRemoteStream(info *interceptor.StreamInfo, reader interceptor.RTPReader) interceptor.RTPReader {
+	if strings.HasPrefix(info.MimeType, "video/") {
+		rc.mu.Lock()
+		rc.streams[info.SSRC] = false
+		rc.mu.Unlock()
+	}
+	return reader
+}
+
+func (rc *rateController) UnbindRemoteStream(info *interceptor.StreamInfo) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	delete(rc.streams, info.SSRC)
+	delete(rc.sent, info.SSRC)
+}
+
+func (rc *rateController) Close() error {
+	rc.closeOnce.Do(func() { close(rc.done) })
+	return nil
+}
+
+// setDowngraded 设置视频流是否降级，降级的流上限不超过容量模型的降级码率，变化时立即下发
+func (rc *rateController) setDowngraded(ssrc uint32, downgraded bool) {
+	rc.mu.Lock()
+	prev, ok := rc.streams[ssrc]
+	rc.streams[ssrc] = downgraded
+	rc.mu.Unlock()
+	if !ok || prev != downgraded {
+		rc.send()
+	}
+}
+
+func (rc *rateController) run() {
+	ticker := time.NewTicker(rc.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rc.done:
+			return
+		case <-ticker.C:
+			rc.send()
+		}
+	}
+}
+
+// send 为每个视频流下发当前的码率上限，没有上限的流不发送
+func (rc *rateController) send() {
+	state := rc.control.state()
+	limit := rc.policy.Cap(state.model, state.language, rc.capacity.Utilization())
+	downgrade := rc.capacity.Downgrade().Bitrate
+
+	rc.mu.Lock()
+	writer := rc.writer
+	var packets []rtcp.Packet
+	for ssrc, downgraded := range rc.streams {
+		streamLimit := limit
+		if downgraded && (streamLimit == 0 || downgrade < streamLimit) {
+			streamLimit = downgrade
+		}
+		if streamLimit == 0 {
+			continue
+		}
+		if rc.sent[ssrc] != streamLimit {
+			rc.logger.Debug("sender bitrate cap changed", "ssrc", ssrc, "bitrate", streamLimit, "downgraded", downgraded)
+			rc.sent[ssrc] = streamLimit
+		}
+		packets = append(packets, &rtcp.ReceiverEstimatedMaximumBitrate{Bitrate: float32(streamLimit), SSRCs: []uint32{ssrc}})
+	}
+	rc.mu.Unlock()
+
+	if writer == nil || len(packets) == 0 {
+		return
+	}
+	if _, err := writer.Write(packets, interceptor.Attributes{}); err != nil {
+		rc.logger.Debug("failed to send REMB", "error", err)
+	}
+}
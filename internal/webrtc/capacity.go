@@ -0,0 +1,187 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/capacity"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/pion/webrtc/v3"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// capacityCheckInterval 按实际解码的分辨率与帧率更新容量占用的间隔
+const capacityCheckInterval = time.Second
+
+// trackCapacity 一路视频轨道的容量占用，只在读取该轨道的 goroutine 中使用
+type trackCapacity struct {
+	reservation *capacity.Reservation
+	model       *capacity.Model
+	rate        *rateController
+	ssrc        uint32
+	logger      *slog.Logger
+
+	downgraded   bool
+	lastCheck    time.Time
+	lastDecoded  uint64
+	lastReceived uint64
+}
+
+func newTrackCapacity(model *capacity.Model, reservation *capacity.Reservation, rate *rateController, ssrc uint32, logger *slog.Logger) *trackCapacity {
+	return &trackCapacity{
+		reservation: reservation,
+		model:       model,
+		rate:        rate,
+		ssrc:        ssrc,
+		logger:      logger,
+		lastCheck:   time.Now(),
+	}
+}
+
+// check 每隔 capacityCheckInterval 按实际解码的帧率更新成本，并按结果调整降级状态
+func (tc *trackCapacity) check(pipeline *TrackPipeline, now time.Time) {
+	elapsed := now.Sub(tc.lastCheck)
+	if elapsed < capacityCheckInterval {
+		return
+	}
+	decoded, received := pipeline.Sequence(), pipeline.Received()
+	decodedFPS := float64(decoded-tc.lastDecoded) / elapsed.Seconds()
+	inputFPS := float64(received-tc.lastReceived) / elapsed.Seconds()
+	tc.lastCheck, tc.lastDecoded, tc.lastReceived = now, decoded, received
+	downgraded := tc.reservation.Downgraded()
+	if width, height := pipeline.Resolution(); width > 0 {
+		downgraded = tc.reservation.Update(width, height, decodedFPS, inputFPS)
+	}
+	tc.apply(pipeline, downgraded)
+}
+
+// apply 降级时通过 REMB 限制客户端码率，并只解码关键帧
+func (tc *trackCapacity) apply(pipeline *TrackPipeline, downgraded bool) {
+	if downgraded == tc.downgraded {
+		return
+	}
+	tc.downgraded = downgraded
+	spec := tc.model.Downgrade()
+	if downgraded {
+		tc.logger.Info("track downgraded for decoder capacity", "bitrate", spec.Bitrate, "keyframe_fps", spec.FPS)
+		pipeline.SetKeyFrameInterval(time.Duration(float64(time.Second) / spec.FPS))
+	} else {
+		tc.logger.Info("track downgrade lifted")
+		pipeline.SetKeyFrameInterval(0)
+	}
+	tc.rate.setDowngraded(tc.ssrc, downgraded)
+}
+
+// parseVideoSpec 解析客户端通过 ?video= 声明的发送规格，格式为 <width>x<height>[@<fps>]，例如 1280x720@30
+func parseVideoSpec(v string) (config.StreamSpec, error) {
+	var spec config.StreamSpec
+	if v == "" {
+		return spec, nil
+	}
+	size, fps, hasFPS := strings.Cut(v, "@")
+	w, h, ok := strings.Cut(size, "x")
+	var err error
+	if ok {
+		spec.Width, err = strconv.Atoi(w)
+		if err == nil {
+			spec.Height, err = strconv.Atoi(h)
+		}
+	}
+	if hasFPS && err == nil {
+		spec.FPS, err = strconv.ParseFloat(fps, 64)
+	}
+	if !ok || err != nil || spec.Width <= 0 || spec.Height <= 0 || spec.Width > maxVideoSize || spec.Height > maxVideoSize ||
+		hasFPS && (spec.FPS <= 0 || spec.FPS > maxVideoFPS) {
+		return config.StreamSpec{}, fmt.Errorf("invalid video %q, want <width>x<height>[@<fps>]", v)
+	}
+	return spec, nil
+}
+
+// 客户端声明规格的上限
+const (
+	maxVideoSize = 8192
+	maxVideoFPS  = 240
+)
+
+// negotiatedSpec 从远端 SDP 中 mid 所在 m= 段的 a=imageattr 与 a=framerate 读取发送端的分辨率与帧率，
+// 只识别 send [x=<width>,y=<height>] 这样的固定值，没有时对应字段为 0
+func negotiatedSpec(desc *webrtc.SessionDescription, mid string) config.StreamSpec {
+	var spec config.StreamSpec
+	if desc == nil || mid == "" {
+		return spec
+	}
+	parsed, err := desc.Unmarshal()
+	if err != nil {
+		return spec
+	}
+	for _, media := range parsed.MediaDescriptions {
+		if v, _ := media.Attribute("mid"); v != mid {
+			continue
+		}
+		if v, ok := media.Attribute("framerate"); ok {
+			if fps, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && fps > 0 && fps <= maxVideoFPS {
+				spec.FPS = fps
+			}
+		}
+		if v, ok := media.Attribute("imageattr"); ok {
+			spec.Width, spec.Height = parseImageAttr(v)
+		}
+	}
+	return spec
+}
+
+// parseImageAttr 解析 a=imageattr 中 send 的固定分辨率，例如 "96 send [x=1280,y=720] recv *"
+func parseImageAttr(v string) (int, int) {
+	_, send, ok := strings.Cut(v, " send ")
+	if !ok {
+		return 0, 0
+	}
+	start, end := strings.Index(send, "["), strings.Index(send, "]")
+	if start < 0 || end < start {
+		return 0, 0
+	}
+	var width, height int
+	for _, kv := range strings.Split(send[start+1:end], ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(kv), "=")
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxVideoSize {
+			continue
+		}
+		switch key {
+		case "x":
+			width = n
+		case "y":
+			height = n
+		}
+	}
+	if width == 0 || height == 0 {
+		return 0, 0
+	}
+	return width, height
+}
+
+// announcedSpec 合并客户端 ?video= 声明的规格与 SDP 协商的规格，?video= 优先，都没有的字段为 0
+func announcedSpec(announced, negotiated config.StreamSpec) config.StreamSpec {
+	spec := negotiated
+	if announced.Width > 0 {
+		spec.Width, spec.Height = announced.Width, announced.Height
+	}
+	if announced.FPS > 0 {
+		spec.FPS = announced.FPS
+	}
+	return spec
+}
+
+// handleCapacity 返回节点当前的解码容量
+func (s *SignalingServer) handleCapacity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.capacity.Status())
+}
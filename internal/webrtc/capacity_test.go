@@ -0,0 +1,89 @@
+package webrtc
+
+import (
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/pion/webrtc/v3"
+	"testing"
+	"time"
+)
+
+func TestParseVideoSpec(t *testing.T) {
+	for in, want := range map[string]config.StreamSpec{
+		"":             {},
+		"1280x720":     {Width: 1280, Height: 720},
+		"640x480@15.5": {Width: 640, Height: 480, FPS: 15.5},
+	} {
+		got, err := parseVideoSpec(in)
+		if err != nil || got != want {
+			t.Errorf("parseVideoSpec(%q) = %+v, %v, want %+v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"720p", "1280x", "0x720", "1280x720@0", "1280x720@fast", "99999x720"} {
+		if _, err := parseVideoSpec(in); err == nil {
+			t.Errorf("parseVideoSpec(%q) accepted", in)
+		}
+	}
+}
+
+func TestNegotiatedSpec(t *testing.T) {
+	desc := &webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: "v=0\r\n" +
+		"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+		"s=-\r\n" +
+		"t=0 0\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+		"a=mid:0\r\n" +
+		"a=framerate:60\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96\r\n" +
+		"a=mid:1\r\n" +
+		"a=framerate:24\r\n" +
+		"a=imageattr:96 send [x=1280,y=720] recv *\r\n"}
+	got := negotiatedSpec(desc, "1")
+	if want := (config.StreamSpec{Width: 1280, Height: 720, FPS: 24}); got != want {
+		t.Fatalf("negotiatedSpec = %+v, want %+v", got, want)
+	}
+	// ?video= 优先于 SDP
+	merged := announcedSpec(config.StreamSpec{FPS: 30}, got)
+	if want := (config.StreamSpec{Width: 1280, Height: 720, FPS: 30}); merged != want {
+		t.Fatalf("announcedSpec = %+v, want %+v", merged, want)
+	}
+	if got := negotiatedSpec(desc, "2"); got != (config.StreamSpec{}) {
+		t.Fatalf("unknown mid: %+v", got)
+	}
+}
+
+func TestKeyFrameGate(t *testing.T) {
+	key, delta := []byte{0}, []byte{1}
+	requests := 0
+	g := keyFrameGate{isKeyFrame: func(f []byte) bool { return f[0] == 0 }, request: func() { requests++ }}
+	now := time.Unix(0, 0)
+	step := func(frame []byte) bool {
+		now = now.Add(100 * time.Millisecond)
+		return g.admit(frame, now)
+	}
+
+	if !step(key) || !step(delta) {
+		t.Fatal("frames skipped before downgrade")
+	}
+	// 降级后只解码关键帧，每 300ms 请求一次关键帧
+	g.setInterval(300 * time.Millisecond)
+	for i := 0; i < 6; i++ {
+		if step(delta) {
+			t.Fatalf("delta frame %d decoded while downgraded", i)
+		}
+	}
+	if requests != 2 {
+		t.Fatalf("key frame requests = %d, want 2", requests)
+	}
+	if !step(key) || step(delta) {
+		t.Fatal("unexpected decision after a key frame while downgraded")
+	}
+	// 恢复后立即请求关键帧，在关键帧之前不解码
+	g.setInterval(0)
+	requests = 0
+	if step(delta) || requests != 1 {
+		t.Fatalf("delta frame decoded before a key frame, requests %d", requests)
+	}
+	if !step(key) || !step(delta) {
+		t.Fatal("frames skipped after the downgrade was lifted")
+	}
+}
@@ -0,0 +1,162 @@
+package webrtc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/cluster"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// SessionStatus /admin/sessions/{id} 的响应
+type SessionStatus struct {
+	SessionID         string `json:"session_id"`
+	Node              string `json:"node,omitempty"`
+	SignalingAttached bool   `json:"signaling_attached"`
+	ConnectionState   string `json:"connection_state"`
+	ICEState          string `json:"ice_state"`
+}
+
+// clusterNode 多实例部署时本实例在会话目录中的信息，未启用集群模式时为 nil
+type clusterNode struct {
+	owner     cluster.Owner
+	directory cluster.Directory
+	forwarder *cluster.Forwarder
+	ttl       time.Duration
+	logger    *slog.Logger
+}
+
+func newClusterNode(cfg config.ClusterConfig, logger *slog.Logger) (*clusterNode, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	node := cfg.NodeID
+	if node == "" {
+		node, _ = os.Hostname()
+	}
+	directory, err := cluster.NewDirectory(context.Background(), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create session directory: %w", err)
+	}
+	logger.Info("cluster mode enabled", "node", node, "advertise_url", cfg.AdvertiseURL, "directory", cfg.Directory)
+	return &clusterNode{
+		owner:     cluster.Owner{Node: node, URL: cfg.AdvertiseURL},
+		directory: directory,
+		forwarder: &cluster.Forwarder{Node: node, Mode: cfg.Forward, Logger: logger},
+		ttl:       cfg.TTL,
+		logger:    logger,
+	}, nil
+}
+
+func tokenKey(token string) string {
+	return "token/" + token
+}
+
+func sessionKey(id string) string {
+	return "session/" + id
+}
+
+// announce 将会话登记到目录，未启用集群模式时不做任何事
+func (c *clusterNode) announce(sessionID, token string) {
+	if c == nil {
+		return
+	}
+	for _, key := range []string{tokenKey(token), sessionKey(sessionID)} {
+		if err := c.directory.Register(context.Background(), key, c.owner, c.ttl); err != nil {
+			c.logger.Warn("failed to register session in directory", "key", key, "error", err)
+		}
+	}
+}
+
+// withdraw 从目录中删除记录
+func (c *clusterNode) withdraw(keys ...string) {
+	if c == nil {
+		return
+	}
+	for _, key := range keys {
+		if err := c.directory.Unregister(context.Background(), key); err != nil {
+			c.logger.Warn("failed to unregister session from directory", "key", key, "error", err)
+		}
+	}
+}
+
+// forward 会话属于其他实例时将请求转发过去并返回 true；已被转发过的请求不再转发
+func (c *clusterNode) forward(w http.ResponseWriter, r *http.Request, key string) bool {
+	if c == nil || cluster.Forwarded(r) {
+		return false
+	}
+	owner, err := c.directory.Lookup(r.Context(), key)
+	if err != nil {
+		if !errors.Is(err, cluster.ErrNotFound) {
+			c.logger.Warn("session directory lookup failed", "key", key, "error", err)
+		}
+		return false
+	}
+	if owner.Node == c.owner.Node {
+		return false
+	}
+	c.forwarder.Forward(w, r, owner)
+	return true
+}
+
+// refreshDirectory 定期刷新本实例全部会话的目录记录，直到 ctx 结束
+func (s *SignalingServer) refreshDirectory(ctx context.Context) {
+	if s.cluster == nil {
+		return
+	}
+	ticker := time.NewTicker(s.cluster.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			owned := make(map[string]string, len(s.sessions))
+			for token, sess := range s.sessions {
+				owned[token] = sess.id
+			}
+			s.mu.Unlock()
+			for token, id := range owned {
+				s.cluster.announce(id, token)
+			}
+		}
+	}
+}
+
+// handleSessionStatus 返回会话状态，会话属于其他实例时转发
+func (s *SignalingServer) handleSessionStatus(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var sess *session
+	s.mu.Lock()
+	for _, candidate := range s.sessions {
+		if candidate.id == id {
+			sess = candidate
+			break
+		}
+	}
+	s.mu.Unlock()
+	if sess == nil {
+		if !s.cluster.forward(w, r, sessionKey(id)) {
+			http.Error(w, "session not found", http.StatusNotFound)
+		}
+		return
+	}
+
+	status := SessionStatus{
+		SessionID:         sess.id,
+		SignalingAttached: sess.attached(),
+		ConnectionState:   sess.manager.PeerConnection.ConnectionState().String(),
+		ICEState:          sess.manager.PeerConnection.ICEConnectionState().String(),
+	}
+	if s.cluster != nil {
+		status.Node = s.cluster.owner.Node
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,224 @@
+package webrtc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// 控制命令的 action
+const (
+	ActionPause    = "pause"
+	ActionResume   = "resume"
+	ActionSetModel = "set_model"
+	ActionSetFPS   = "set_fps"
+	ActionSnapshot = "snapshot"
+	ActionSetROI   = "set_roi"
+)
+
+// maxTargetFPS set_fps 允许的最大帧率
+const maxTargetFPS = 60
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// ControlMessage 客户端通过 DataChannel 或 WebSocket 以 type "control" 发送的控制命令
+type ControlMessage struct {
+	Action string `json:"action"`
+	// Language 与 Model 用于 set_model，为空的字段保持不变
+	Language string `json:"language,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// FPS 用于 set_fps，0 表示不限制
+	FPS float64 `json:"fps,omitempty"`
+	// ROI 用于 set_roi，为空表示使用整帧
+	ROI *ROI `json:"roi,omitempty"`
+}
+
+// ControlResult 对控制命令的应答，以 type "control_result" 下发
+type ControlResult struct {
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ROI 识别区域，坐标按帧宽高归一化到 [0, 1]，原点在左上角
+type ROI struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Snapshot snapshot 命令的应答，以 type "snapshot" 下发送往识别的下一帧
+type Snapshot struct {
+	TrackID  string `json:"track_id"`
+	Sequence uint64 `json:"sequence"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	// Image JPEG 图片的 data URL
+	Image string `json:"image"`
+}
+
+func (r ROI) validate() error {
+	if r.X < 0 || r.Y < 0 || r.Width <= 0 || r.Height <= 0 || r.X+r.Width > 1 || r.Y+r.Height > 1 {
+		return fmt.Errorf("roi %+v must lie within the frame", r)
+	}
+	return nil
+}
+
+// SessionControl 会话的控制状态，由该会话的全部视频轨道共享
+type SessionControl struct {
+	mu        sync.Mutex
+	paused    bool
+	language  string
+	model     string
+	interval  time.Duration
+	roi       *ROI
+	snapshots uint64
+}
+
+// controlState 某一时刻的控制状态
+type controlState struct {
+	paused    bool
+	language  string
+	model     string
+	interval  time.Duration
+	roi       *ROI
+	snapshots uint64
+}
+
+// Handle 应用一条控制命令
+func (c *SessionControl) Handle(msg ControlMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch msg.Action {
+	case ActionPause:
+		c.paused = true
+	case ActionResume:
+		c.paused = false
+	case ActionSetModel:
+		if msg.Language == "" && msg.Model == "" {
+			return errors.New("language or model is required")
+		}
+		for _, v := range []string{msg.Language, msg.Model} {
+			if v != "" && !identifierPattern.MatchString(v) {
+				return fmt.Errorf("invalid identifier %q", v)
+			}
+		}
+		if msg.Language != "" {
+			c.language = msg.Language
+		}
+		if msg.Model != "" {
+			c.model = msg.Model
+		}
+	case ActionSetFPS:
+		if msg.FPS < 0 || msg.FPS > maxTargetFPS {
+			return fmt.Errorf("fps must be between 0 and %d", maxTargetFPS)
+		}
+		c.interval = 0
+		if msg.FPS > 0 {
+			c.interval = time.Duration(float64(time.Second) / msg.FPS)
+		}
+	case ActionSnapshot:
+		c.snapshots++
+	case ActionSetROI:
+		if msg.ROI != nil {
+			if err := msg.ROI.validate(); err != nil {
+				return err
+			}
+			roi := *msg.ROI
+			c.roi = &roi
+		} else {
+			c.roi = nil
+		}
+	default:
+		return fmt.Errorf("unknown action %q", msg.Action)
+	}
+	return nil
+}
+
+func (c *SessionControl) state() controlState {
+	if c == nil {
+		return controlState{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return controlState{
+		paused:    c.paused,
+		language:  c.language,
+		model:     c.model,
+		interval:  c.interval,
+		roi:       c.roi,
+		snapshots: c.snapshots,
+	}
+}
+
+// handleControl 解析并应用控制命令，返回给客户端的应答
+func handleControl(control *SessionControl, data json.RawMessage) ControlResult {
+	var msg ControlMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return ControlResult{Error: "invalid control message"}
+	}
+	result := ControlResult{Action: msg.Action}
+	if err := control.Handle(msg); err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// cropFrame 按 ROI 裁剪帧，返回新的 Frame，原帧的数据不被修改
+func cropFrame(frame *Frame, roi ROI) (*Frame, error) {
+	bpp, ok := bytesPerPixel[frame.PixelFormat]
+	if !ok {
+		return nil, fmt.Errorf("pixel format %s not supported", frame.PixelFormat)
+	}
+	if len(frame.Data) < frame.Width*frame.Height*bpp {
+		return nil, fmt.Errorf("frame too short: %d bytes for %dx%d", len(frame.Data), frame.Width, frame.Height)
+	}
+	x0 := int(roi.X * float64(frame.Width))
+	y0 := int(roi.Y * float64(frame.Height))
+	x1 := min(int((roi.X+roi.Width)*float64(frame.Width)+0.5), frame.Width)
+	y1 := min(int((roi.Y+roi.Height)*float64(frame.Height)+0.5), frame.Height)
+	if x1 <= x0 || y1 <= y0 {
+		return nil, fmt.Errorf("roi %+v is empty for %dx%d", roi, frame.Width, frame.Height)
+	}
+
+	width, height := x1-x0, y1-y0
+	data := make([]byte, 0, width*height*bpp)
+	stride := frame.Width * bpp
+	for y := y0; y < y1; y++ {
+		row := frame.Data[y*stride:]
+		data = append(data, row[x0*bpp:x1*bpp]...)
+	}
+	cropped := *frame
+	cropped.Width, cropped.Height, cropped.Data = width, height, data
+	return &cropped, nil
+}
+
+var bytesPerPixel = map[string]int{
+	"rgba":  4,
+	"rgb24": 3,
+}
+
+// newSnapshot 将帧编码为 JPEG
+func newSnapshot(frame *Frame) (Snapshot, error) {
+	img, err := frame.Image()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		return Snapshot{}, fmt.Errorf("encoding snapshot: %w", err)
+	}
+	return Snapshot{
+		TrackID:  frame.TrackID,
+		Sequence: frame.Sequence,
+		Width:    frame.Width,
+		Height:   frame.Height,
+		Image:    "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
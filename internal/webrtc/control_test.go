@@ -0,0 +1,87 @@
+package webrtc
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSessionControl(t *testing.T) {
+	c := &SessionControl{}
+	steps := []ControlMessage{
+		{Action: ActionPause},
+		{Action: ActionSetModel, Language: "csl", Model: "csl-v2"},
+		{Action: ActionSetFPS, FPS: 10},
+		{Action: ActionSetROI, ROI: &ROI{X: 0.25, Y: 0, Width: 0.5, Height: 1}},
+		{Action: ActionSnapshot},
+	}
+	for _, msg := range steps {
+		if err := c.Handle(msg); err != nil {
+			t.Fatalf("Handle(%+v) failed: %v", msg, err)
+		}
+	}
+	state := c.state()
+	if !state.paused || state.language != "csl" || state.model != "csl-v2" || state.interval != 100*time.Millisecond || state.roi == nil || state.snapshots != 1 {
+		t.Fatalf("unexpected state %+v", state)
+	}
+
+	for _, msg := range []ControlMessage{
+		{Action: "reboot"},
+		{Action: ActionSetModel},
+		{Action: ActionSetModel, Model: "../etc/passwd"},
+		{Action: ActionSetFPS, FPS: 1000},
+		{Action: ActionSetROI, ROI: &ROI{X: 0.5, Y: 0, Width: 0.6, Height: 1}},
+	} {
+		if err := c.Handle(msg); err == nil {
+			t.Errorf("Handle(%+v) succeeded, want error", msg)
+		}
+	}
+
+	if err := c.Handle(ControlMessage{Action: ActionResume}); err != nil || c.state().paused {
+		t.Fatalf("resume failed: %v", err)
+	}
+	if err := c.Handle(ControlMessage{Action: ActionSetROI}); err != nil || c.state().roi != nil {
+		t.Fatalf("clearing roi failed: %v", err)
+	}
+}
+
+func TestCropFrame(t *testing.T) {
+	// 4x2 的 rgb24 帧，每个像素的值为其序号
+	frame := &Frame{Width: 4, Height: 2, PixelFormat: "rgb24"}
+	for i := 0; i < 8; i++ {
+		frame.Data = append(frame.Data, byte(i), byte(i), byte(i))
+	}
+	cropped, err := cropFrame(frame, ROI{X: 0.25, Y: 0.5, Width: 0.5, Height: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{5, 5, 5, 6, 6, 6}
+	if cropped.Width != 2 || cropped.Height != 1 || !bytes.Equal(cropped.Data, want) {
+		t.Fatalf("cropped = %dx%d %v, want 2x1 %v", cropped.Width, cropped.Height, cropped.Data, want)
+	}
+	if frame.Width != 4 || len(frame.Data) != 24 {
+		t.Fatal("original frame modified")
+	}
+}
+
+func TestPipelineFrameRate(t *testing.T) {
+	p := &TrackPipeline{}
+	start := time.Unix(0, 0)
+	delivered := 0
+	// 30fps 输入且到达时间有抖动，限制为 10fps
+	for i := 0; i < 90; i++ {
+		at := start.Add(time.Duration(i) * time.Second / 30)
+		if i%2 == 1 {
+			at = at.Add(-2 * time.Millisecond)
+		}
+		if p.due(at, 100*time.Millisecond) {
+			delivered++
+		}
+	}
+	if delivered != 30 {
+		t.Fatalf("delivered %d frames in 3s, want 30", delivered)
+	}
+	if !p.due(start, 0) {
+		t.Fatal("frame dropped without a target frame rate")
+	}
+}
@@ -0,0 +1,101 @@
+package webrtc
+
+import (
+	"context"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/dataset"
+	"github.com/haowei703/webrtc-server/internal/grpc"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// consentDataset 客户端同意其视频帧被导出为训练数据
+const consentDataset = "dataset"
+
+// DatasetSink 按间隔采样帧，与推理结果一起导出为训练数据
+type DatasetSink struct {
+	writer   *dataset.Writer
+	format   string
+	interval time.Duration
+	last     time.Time
+}
+
+func NewDatasetSink(cfg config.DatasetConfig, sc SinkContext) (*DatasetSink, error) {
+	writer, err := dataset.NewWriter(cfg, sc.SessionID, sc.TrackID, sc.Consent)
+	if err != nil {
+		return nil, err
+	}
+	if sc.Results != nil {
+		sc.Results.Subscribe(func(sequence uint64, result grpc.Result) {
+			if err := writer.SetResult(sequence, result.Label); err != nil {
+				sc.Logger.Warn("failed to write dataset manifest", "error", err)
+			}
+		})
+	}
+	return &DatasetSink{writer: writer, format: cfg.Format, interval: cfg.Interval}, nil
+}
+
+func (d *DatasetSink) HandleFrame(_ context.Context, frame *Frame) error {
+	if d.writer.Full() || frame.ReceivedAt.Sub(d.last) < d.interval {
+		return nil
+	}
+	d.last = frame.ReceivedAt
+
+	sample := dataset.Sample{
+		Sequence:     frame.Sequence,
+		RTPTimestamp: frame.RTPTimestamp,
+		ReceivedAt:   frame.ReceivedAt,
+		Width:        frame.Width,
+		Height:       frame.Height,
+	}
+	if d.format == "npz" {
+		sample.Pix = frame.Data
+		sample.Channels = 4
+		if frame.PixelFormat == "rgb24" {
+			sample.Channels = 3
+		}
+	} else {
+		img, err := frame.Image()
+		if err != nil {
+			return err
+		}
+		sample.Image = img
+	}
+	return d.writer.Add(sample)
+}
+
+func (d *DatasetSink) Close() error {
+	return d.writer.Close()
+}
+
+// nopSink 丢弃所有帧，用于未获授权的会话
+type nopSink struct{}
+
+func (nopSink) HandleFrame(context.Context, *Frame) error { return nil }
+func (nopSink) Close() error                              { return nil }
+
+// datasetPruner 在新会话开始导出时按保留策略清理旧数据，同一时间只运行一次
+type datasetPruner struct {
+	running atomic.Bool
+}
+
+// prune 清理时跳过 active 返回的仍在进行的会话，其数据可能正在写入
+func (p *datasetPruner) prune(cfg config.DatasetConfig, active func() map[string]bool, logger *slog.Logger) {
+	if cfg.Retention.MaxAge <= 0 && cfg.Retention.MaxTotalSize <= 0 {
+		return
+	}
+	if !p.running.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer p.running.Store(false)
+		removed, err := dataset.Prune(cfg.Dir, cfg.Retention, time.Now(), active())
+		if err != nil {
+			logger.Warn("failed to prune dataset", "error", err)
+		}
+		if len(removed) > 0 {
+			logger.Info("pruned dataset sessions", "removed", len(removed))
+		}
+	}()
+}
@@ -1,47 +1,58 @@
 package webrtc
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/asticode/go-astiav"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/logging"
 	"github.com/pion/rtp"
-	"image/png"
-	"log"
-	"os"
+	"log/slog"
+	"strings"
 	"sync"
-	"time"
 )
 
-var unmarshallerMap = map[string]PacketUnmarshaller{
-	"VP8":  &VP8PacketUnmarshaller{},
-	"VP9":  &VP9PacketUnmarshaller{},
-	"H264": &H264PacketUnmarshaller{},
-	"H265": &H265PacketUnmarshaller{},
+// unmarshallerMap 每个解码器使用独立的 PacketUnmarshaller，避免多个会话共享帧缓冲
+var unmarshallerMap = map[string]func() PacketUnmarshaller{
+	"VP8":  func() PacketUnmarshaller { return &VP8PacketUnmarshaller{} },
+	"VP9":  func() PacketUnmarshaller { return &VP9PacketUnmarshaller{} },
+	"H264": func() PacketUnmarshaller { return &H264PacketUnmarshaller{} },
+	"H265": func() PacketUnmarshaller { return &H265PacketUnmarshaller{} },
 }
 
 // VideoDecoder 视频解码器
 type VideoDecoder struct {
 	ctx          *astiav.CodecContext
 	unmarshaller PacketUnmarshaller
+	outputFormat astiav.PixelFormat
+	logger       *slog.Logger
 	mu           sync.Mutex // 用于并发保护 frameBuffer
 }
 
-func NewVideoDecoder(codec string) (*VideoDecoder, error) {
-	vd := &VideoDecoder{}
-	unmarshaller, ok := unmarshallerMap[codec]
+var pixelFormats = map[string]astiav.PixelFormat{
+	"rgba":  astiav.PixelFormatRgba,
+	"rgb24": astiav.PixelFormatRgb24,
+}
+
+func NewVideoDecoder(codec string, cfg config.DecoderConfig, logger *slog.Logger) (*VideoDecoder, error) {
+	vd := &VideoDecoder{logger: logger.With(logging.KeyCodec, codec)}
+	outputFormat, ok := pixelFormats[cfg.PixelFormat]
+	if !ok {
+		return nil, fmt.Errorf("pixel format %s not supported", cfg.PixelFormat)
+	}
+	vd.outputFormat = outputFormat
+	newUnmarshaller, ok := unmarshallerMap[codec]
 	if !ok {
 		return nil, fmt.Errorf("video decoder for %s not supported", codec)
 	}
-	vd.unmarshaller = unmarshaller
+	vd.unmarshaller = newUnmarshaller()
 	err := vd.initDecoder(codec)
 	return vd, err
 }
 
 // initDecoder initializes the VP8 videoCodec context
 func (vd *VideoDecoder) initDecoder(codec string) error {
-	// Initialize FFmpeg
-	astiav.SetLogLevel(astiav.LogLevelDebug)
-
 	var videoCodec *astiav.Codec
 	switch codec {
 	case "VP8":
@@ -58,7 +69,7 @@ func (vd *VideoDecoder) initDecoder(codec string) error {
 		return fmt.Errorf("unsupported codec")
 	}
 
-	log.Printf("The decoder currently in use is %s\n", codec)
+	vd.logger.Info("video decoder initialized")
 
 	// Allocate a codec context for the videoCodec
 	codecContext := astiav.AllocCodecContext(videoCodec)
@@ -75,21 +86,23 @@ func (vd *VideoDecoder) initDecoder(codec string) error {
 	return nil
 }
 
-// processRTPPacket 处理RTP包
-func (vd *VideoDecoder) processRTPPacket(packet *rtp.Packet) ([]byte, int, int, error) {
+// assemble 处理RTP包，收齐一帧时返回完整的编码数据，视频帧不完整则返回nil
+func (vd *VideoDecoder) assemble(packet *rtp.Packet) ([]byte, error) {
 	vd.mu.Lock()
 	defer vd.mu.Unlock()
 
 	frame, err := vd.unmarshaller.Unmarshal(packet)
 	if err != nil {
-		return nil, 0, 0, fmt.Errorf("error unmarshalling payload: %w", err)
-	}
-	if frame != nil {
-		return vd.decodeFrameToRGBArray(frame)
+		return nil, fmt.Errorf("error unmarshalling payload: %w", err)
 	}
+	return frame, nil
+}
 
-	// 视频帧不完整则返回nil
-	return nil, 0, 0, nil
+// decode 将 assemble 得到的一帧解码为输出像素格式
+func (vd *VideoDecoder) decode(frame []byte) ([]byte, int, int, error) {
+	vd.mu.Lock()
+	defer vd.mu.Unlock()
+	return vd.decodeFrameToRGBArray(frame)
 }
 
 // decodeFrameToRGBArray 视频帧解码为RGB格式
@@ -100,7 +113,7 @@ func (vd *VideoDecoder) decodeFrameToRGBArray(input []byte) ([]byte, int, int, e
 
 	packet := astiav.AllocPacket()
 	if packet == nil {
-		log.Fatal("could not allocate packet")
+		return nil, 0, 0, fmt.Errorf("could not allocate packet")
 	}
 
 	defer packet.Free()
@@ -125,7 +138,7 @@ func (vd *VideoDecoder) decodeFrameToRGBArray(input []byte) ([]byte, int, int, e
 	// 创建一个用于RGB数据的Frame
 	rgbFrame := astiav.AllocFrame()
 	defer rgbFrame.Free()
-	rgbFrame.SetPixelFormat(astiav.PixelFormatRgba)
+	rgbFrame.SetPixelFormat(vd.outputFormat)
 	rgbFrame.SetWidth(frame.Width())
 	rgbFrame.SetHeight(frame.Height())
 	if err := rgbFrame.AllocBuffer(1); err != nil {
@@ -150,7 +163,7 @@ func (vd *VideoDecoder) decodeFrameToRGBArray(input []byte) ([]byte, int, int, e
 
 	data, err := rgbFrame.Data().Bytes(1)
 	if len(data) == 0 || err != nil {
-		log.Printf("Decoded RGB data size: %d bytes", len(data))
+		vd.logger.Debug("no RGB data in decoded frame", "size", len(data), "error", err)
 		return nil, 0, 0, fmt.Errorf("no RGB data found")
 	}
 	rgbData := make([]byte, len(data))
@@ -158,28 +171,44 @@ func (vd *VideoDecoder) decodeFrameToRGBArray(input []byte) ([]byte, int, int, e
 	return rgbData, frame.Width(), frame.Height(), nil
 }
 
-func (vd *VideoDecoder) writeToFile(rgbFrame *astiav.Frame) error {
-	img, err := rgbFrame.Data().GuessImageFormat()
-	if err != nil {
-		return fmt.Errorf("error guessing RGB frame format: %w", err)
-	}
-
-	err = rgbFrame.Data().ToImage(img)
-	if err != nil {
-		return fmt.Errorf("error converting RGB frame to image: %w", err)
-	}
-	directory := "debug/"
-	fileName := fmt.Sprintf("%s%s.png", directory, time.Now().Format("2006-01-02_15-04-05"))
-	dstFile, err := os.Create(fileName)
-	if err != nil {
-		log.Fatal(fmt.Errorf("main: creating %s failed: %w", "test.png", err))
-	}
-	defer dstFile.Close()
-
-	if err = png.Encode(dstFile, img); err != nil {
-		encodeErr := fmt.Errorf("main: encoding to png failed: %w", err)
-		log.Fatal(encodeErr, err)
-		return encodeErr
-	}
-	return nil
+// RouteFFmpegLogs 将 FFmpeg 的日志转发到结构化日志中，进程内调用一次即可
+func RouteFFmpegLogs(logger *slog.Logger) {
+	logger = logger.With("component", "ffmpeg")
+	ctx := context.Background()
+
+	// 只让 FFmpeg 产生 logger 会记录的级别，避免无意义的格式化开销
+	switch {
+	case logger.Enabled(ctx, slog.LevelDebug):
+		astiav.SetLogLevel(astiav.LogLevelDebug)
+	case logger.Enabled(ctx, slog.LevelInfo):
+		astiav.SetLogLevel(astiav.LogLevelInfo)
+	case logger.Enabled(ctx, slog.LevelWarn):
+		astiav.SetLogLevel(astiav.LogLevelWarning)
+	default:
+		astiav.SetLogLevel(astiav.LogLevelError)
+	}
+
+	astiav.SetLogCallback(func(c astiav.Classer, l astiav.LogLevel, _, msg string) {
+		var level slog.Level
+		switch {
+		case l <= astiav.LogLevelError:
+			level = slog.LevelError
+		case l <= astiav.LogLevelWarning:
+			level = slog.LevelWarn
+		case l <= astiav.LogLevelInfo:
+			level = slog.LevelInfo
+		default:
+			level = slog.LevelDebug
+		}
+		if !logger.Enabled(ctx, level) {
+			return
+		}
+		attrs := []any{}
+		if c != nil {
+			if cl := c.Class(); cl != nil {
+				attrs = append(attrs, "class", cl.Name())
+			}
+		}
+		logger.Log(ctx, level, strings.TrimSpace(msg), attrs...)
+	})
 }
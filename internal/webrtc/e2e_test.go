@@ -0,0 +1,119 @@
+package webrtc
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/grpc"
+	"github.com/haowei703/webrtc-server/internal/grpc/grpctest"
+	"github.com/haowei703/webrtc-server/internal/signalclient"
+	"github.com/haowei703/webrtc-server/internal/synthetic"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestEndToEnd 客户端通过信令建立连接并发送合成 VP8 视频，期望收到模拟推理服务返回的识别结果
+func TestEndToEnd(t *testing.T) {
+	t.Run("websocket", func(t *testing.T) { testEndToEnd(t, signalclient.Options{}) })
+	t.Run("datachannel", func(t *testing.T) { testEndToEnd(t, signalclient.Options{DataChannel: "results"}) })
+}
+
+func testEndToEnd(t *testing.T, opts signalclient.Options) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	mock := grpctest.NewServer()
+	defer mock.Close()
+	mock.Script(grpctest.Response{Result: "你好"})
+
+	cfg := config.Default()
+	cfg.ICE.Servers = nil
+	cfg.Codecs = []string{"VP8"}
+	cfg.Inference.Endpoints = []string{mock.Target()}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	inference, err := grpc.NewClient(cfg.Inference, logger, mock.DialOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inference.Close()
+
+	server, err := NewSignalingServer(cfg, logger, inference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	client, err := signalclient.Dial(ctx, "ws"+strings.TrimPrefix(ts.URL, "http")+cfg.Signaling.Path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	track, err := client.AddVideoTrack(webrtc.MimeTypeVP8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Negotiate(ctx); err != nil {
+		t.Fatalf("negotiate: %v", err)
+	}
+	if err := client.WaitConnected(ctx); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if opts.DataChannel != "" {
+		if err := client.WaitDataChannel(ctx); err != nil {
+			t.Fatalf("data channel: %v", err)
+		}
+	}
+
+	go func() {
+		frame := synthetic.VP8KeyFrame(64, 48)
+		ticker := time.NewTicker(33 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := track.WriteSample(media.Sample{Data: frame, Duration: 33 * time.Millisecond}); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		select {
+		case msg, ok := <-client.Messages():
+			if !ok {
+				t.Fatal("signaling connection closed")
+			}
+			if msg.Type != "text" {
+				continue
+			}
+			var text struct {
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(msg.Data, &text); err != nil {
+				t.Fatal(err)
+			}
+			if text.Message != "你好" {
+				t.Fatalf("result = %q, want 你好", text.Message)
+			}
+			req := mock.Requests()[0]
+			if req.GetWidth() != 64 || req.GetHeight() != 48 {
+				t.Errorf("frame size = %dx%d, want 64x48", req.GetWidth(), req.GetHeight())
+			}
+			return
+		case <-ctx.Done():
+			t.Fatalf("no result received: %v", ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package webrtc
+
+import "time"
+
+// keyFrameRetryInterval 恢复解码全部帧后等待关键帧时，重复请求关键帧的间隔
+const keyFrameRetryInterval = time.Second
+
+// keyFrameGate 解码容量不足时只让关键帧进入解码器，并定期向发送端请求关键帧；
+// 跳过帧之后参考帧不完整，恢复后要等到下一个关键帧才继续解码。只在读取轨道的 goroutine 中使用
+type keyFrameGate struct {
+	// isKeyFrame 为 nil 时无法按帧判断，所有帧都交给解码器
+	isKeyFrame func(frame []byte) bool
+	// request 向发送端请求关键帧，可为空
+	request func()
+	// interval 只解码关键帧时请求关键帧的间隔，0 表示解码全部帧
+	interval    time.Duration
+	waiting     bool
+	nextRequest time.Time
+}
+
+// setInterval 设置请求关键帧的间隔，0 表示恢复解码全部帧
+func (g *keyFrameGate) setInterval(interval time.Duration) {
+	g.interval = interval
+	g.nextRequest = time.Time{}
+}
+
+// admit 返回该帧是否交给解码器
+func (g *keyFrameGate) admit(frame []byte, now time.Time) bool {
+	if g.isKeyFrame == nil || g.interval == 0 && !g.waiting {
+		return true
+	}
+	if g.isKeyFrame(frame) {
+		g.waiting = false
+		g.nextRequest = now.Add(g.interval)
+		return true
+	}
+	g.waiting = true
+	if !now.Before(g.nextRequest) {
+		retry := g.interval
+		if retry == 0 {
+			retry = keyFrameRetryInterval
+		}
+		g.nextRequest = now.Add(retry)
+		if g.request != nil {
+			g.request()
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"github.com/haowei703/webrtc-server/internal/capacity"
+	"net/http"
+)
+
+// Readiness /readyz 的响应
+type Readiness struct {
+	Ready        bool `json:"ready"`
+	Listening    bool `json:"listening"`
+	ShuttingDown bool `json:"shutting_down"`
+	Sessions     int  `json:"sessions"`
+	// MaxSessions 全局会话上限，0 表示不限制
+	MaxSessions int `json:"max_sessions"`
+	// InferenceHealthy 至少一个推理服务通过 gRPC 健康检查
+	InferenceHealthy bool            `json:"inference_healthy"`
+	Capacity         capacity.Status `json:"capacity"`
+}
+
+// handleHealthz 进程存活即返回 200
+func (s *SignalingServer) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// handleReadyz 正在监听、未达到会话上限、至少一个推理服务健康且不在退出过程中时返回 200，否则返回 503
+func (s *SignalingServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	shuttingDown := s.draining
+	s.mu.Unlock()
+	rd := Readiness{
+		Listening:    s.listening.Load(),
+		ShuttingDown: shuttingDown,
+		Sessions:     s.limiter.Active(),
+		MaxSessions:  s.cfg.Limits.MaxSessions,
+		Capacity:     s.capacity.Status(),
+	}
+	if s.inference != nil {
+		rd.InferenceHealthy = s.inference.Healthy(r.Context())
+	}
+	underCap := rd.MaxSessions == 0 || rd.Sessions < rd.MaxSessions
+	rd.Ready = rd.Listening && !rd.ShuttingDown && underCap && rd.InferenceHealthy
+
+	w.Header().Set("Content-Type", "application/json")
+	if !rd.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(rd)
+}
@@ -0,0 +1,163 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"github.com/pion/webrtc/v3"
+	"sync"
+	"time"
+)
+
+// ICEStateEvent ICE 连接状态变化，以 type "ice_state" 下发
+type ICEStateEvent struct {
+	State string `json:"state"`
+	// Restarting 为 true 表示服务端已发起 ICE restart，随后会收到新的 offer
+	Restarting bool `json:"restarting,omitempty"`
+	// CloseInMS 连接未恢复时会话将在该时长后结束
+	CloseInMS int64 `json:"close_in_ms,omitempty"`
+}
+
+// iceMonitor 根据 ICE 状态发起 ICE restart，超时未恢复时通知会话结束
+type iceMonitor struct {
+	sess           *session
+	restartDelay   time.Duration
+	failureTimeout time.Duration
+
+	mu       sync.Mutex
+	state    webrtc.ICEConnectionState
+	restart  *time.Timer
+	failure  *time.Timer
+	deadline time.Time
+	// failed 超时未恢复时关闭
+	failed     chan struct{}
+	failedOnce sync.Once
+}
+
+func newICEMonitor(sess *session, restartDelay, failureTimeout time.Duration) *iceMonitor {
+	return &iceMonitor{
+		sess:           sess,
+		restartDelay:   restartDelay,
+		failureTimeout: failureTimeout,
+		failed:         make(chan struct{}),
+	}
+}
+
+func (m *iceMonitor) onStateChange(state webrtc.ICEConnectionState) {
+	logger := m.sess.logger
+	logger.Info("ICE connection state has changed", "state", state.String())
+
+	m.mu.Lock()
+	m.state = state
+	event := ICEStateEvent{State: state.String()}
+	switch state {
+	case webrtc.ICEConnectionStateConnected, webrtc.ICEConnectionStateCompleted:
+		m.stopTimers()
+	case webrtc.ICEConnectionStateDisconnected, webrtc.ICEConnectionStateFailed:
+		if m.failure == nil {
+			m.deadline = time.Now().Add(m.failureTimeout)
+			m.failure = time.AfterFunc(m.failureTimeout, m.fail)
+		}
+		event.CloseInMS = time.Until(m.deadline).Milliseconds()
+		delay := m.restartDelay
+		if state == webrtc.ICEConnectionStateFailed {
+			delay = 0
+		}
+		if delay == 0 {
+			m.restartNow()
+		} else if m.restart == nil {
+			m.restart = time.AfterFunc(delay, m.restartICE)
+		}
+	case webrtc.ICEConnectionStateClosed:
+		m.stopTimers()
+	}
+	m.mu.Unlock()
+
+	if err := m.sess.send("ice_state", event); err != nil {
+		logger.Debug("failed to send ICE state", "error", err)
+	}
+}
+
+// onAttach 信令重新连接时，若 ICE 仍未恢复则立即发起 ICE restart
+func (m *iceMonitor) onAttach() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state != webrtc.ICEConnectionStateDisconnected && m.state != webrtc.ICEConnectionStateFailed {
+		return
+	}
+	m.restartNow()
+}
+
+// restartNow 立即发起 ICE restart，调用方需持有 mu。计时器已触发时 restartICE 正在等待 mu，
+// 不再重新设置，否则会连续发起两次 restart，第二次因协商未完成而失败
+func (m *iceMonitor) restartNow() {
+	if m.restart == nil {
+		m.restart = time.AfterFunc(0, m.restartICE)
+	} else if m.restart.Stop() {
+		m.restart.Reset(0)
+	}
+}
+
+func (m *iceMonitor) restartICE() {
+	m.mu.Lock()
+	m.restart = nil
+	state := m.state
+	closeIn := time.Until(m.deadline).Milliseconds()
+	m.mu.Unlock()
+	if state != webrtc.ICEConnectionStateDisconnected && state != webrtc.ICEConnectionStateFailed {
+		return
+	}
+
+	logger := m.sess.logger
+	if !m.sess.attached() {
+		// 信令断开时无法发送 offer，等待客户端恢复会话
+		logger.Info("ICE restart deferred until signaling is resumed")
+		return
+	}
+	offer, err := m.sess.manager.RestartICE()
+	if err != nil {
+		logger.Warn("failed to restart ICE", "error", err)
+		return
+	}
+	logger.Info("ICE restart initiated", "state", state.String())
+	if err := m.sess.send("ice_state", ICEStateEvent{State: state.String(), Restarting: true, CloseInMS: closeIn}); err != nil {
+		logger.Debug("failed to send ICE state", "error", err)
+	}
+	if err := m.sess.send("offer", offer); err != nil {
+		logger.Warn("failed to send ICE restart offer", "error", err)
+	}
+}
+
+func (m *iceMonitor) fail() {
+	m.sess.logger.Warn("ICE connection not recovered", "timeout", m.failureTimeout)
+	m.failedOnce.Do(func() { close(m.failed) })
+}
+
+// stopTimers 调用方需持有 mu
+func (m *iceMonitor) stopTimers() {
+	if m.restart != nil {
+		m.restart.Stop()
+		m.restart = nil
+	}
+	if m.failure != nil {
+		m.failure.Stop()
+		m.failure = nil
+	}
+}
+
+// stop 会话结束时停止全部计时器
+func (m *iceMonitor) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopTimers()
+}
+
+// handleAnswer 处理客户端对 ICE restart offer 的应答
+func (sess *session) handleAnswer(data json.RawMessage) {
+	var answer webrtc.SessionDescription
+	if err := json.Unmarshal(data, &answer); err != nil {
+		sess.logger.Warn("unmarshal answer error", "error", err, "data", string(data))
+		return
+	}
+	if err := sess.manager.HandleAnswer(answer); err != nil {
+		sess.logger.Warn("HandleAnswer error", "error", err)
+	}
+}
@@ -0,0 +1,175 @@
+package webrtc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/signalclient"
+	"github.com/pion/webrtc/v3"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// connectClient 建立会话并完成协商，返回客户端与服务端的会话
+func connectClient(t *testing.T, cfg *config.Config) (*signalclient.Client, *session) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cfg.Codecs = []string{"VP8"}
+	server, url := newTestServer(t, cfg)
+	client, err := signalclient.Dial(ctx, url, signalclient.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	if _, err := client.AddVideoTrack(webrtc.MimeTypeVP8); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Negotiate(ctx); err != nil {
+		t.Fatalf("negotiate: %v", err)
+	}
+	if err := client.WaitConnected(ctx); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	var info SessionInfo
+	readEvent(t, client, "session", &info)
+	// 等服务端确认连接，避免迟到的 connected 取消测试中发起的 restart
+	readICEState(t, client, webrtc.ICEConnectionStateConnected, false)
+	return client, server.lookupSession(info.ResumeToken)
+}
+
+// readEvent 读取 msgType 类型的下一条消息，跳过其他消息
+func readEvent(t *testing.T, client *signalclient.Client, msgType string, v any) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg, ok := <-client.Messages():
+			if !ok {
+				t.Fatal("signaling connection closed")
+			}
+			if msg.Type != msgType {
+				continue
+			}
+			if err := json.Unmarshal(msg.Data, v); err != nil {
+				t.Fatal(err)
+			}
+			return
+		case <-timeout:
+			t.Fatalf("no %s message received", msgType)
+		}
+	}
+}
+
+// readICEState 读取 state 状态的下一条 ice_state 消息
+func readICEState(t *testing.T, client *signalclient.Client, state webrtc.ICEConnectionState, restarting bool) ICEStateEvent {
+	t.Helper()
+	for {
+		var event ICEStateEvent
+		readEvent(t, client, "ice_state", &event)
+		if event.State == state.String() && event.Restarting == restarting {
+			return event
+		}
+	}
+}
+
+// iceUfrag 返回本端 SDP 中的 ICE 用户名片段，ICE restart 后会改变
+func iceUfrag(t *testing.T, pc *webrtc.PeerConnection) string {
+	t.Helper()
+	desc, err := pc.LocalDescription().Unmarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, media := range desc.MediaDescriptions {
+		if ufrag, ok := media.Attribute("ice-ufrag"); ok {
+			return ufrag
+		}
+	}
+	t.Fatal("no ice-ufrag in local description")
+	return ""
+}
+
+func TestICERestart(t *testing.T) {
+	cases := []struct {
+		state webrtc.ICEConnectionState
+		// wait ice_state 下发后到 restart 的最短时间
+		wait time.Duration
+	}{
+		{webrtc.ICEConnectionStateFailed, 0},
+		{webrtc.ICEConnectionStateDisconnected, 100 * time.Millisecond},
+	}
+	for _, c := range cases {
+		t.Run(c.state.String(), func(t *testing.T) {
+			cfg := config.Default()
+			cfg.ICE.RestartDelay = 100 * time.Millisecond
+			cfg.ICE.FailureTimeout = time.Minute
+			client, sess := connectClient(t, cfg)
+			ufrag := iceUfrag(t, sess.manager.PeerConnection)
+
+			start := time.Now()
+			sess.ice.onStateChange(c.state)
+			if event := readICEState(t, client, c.state, false); event.CloseInMS <= 0 {
+				t.Fatalf("state event %+v, want close_in_ms", event)
+			}
+			readICEState(t, client, c.state, true)
+			if elapsed := time.Since(start); elapsed < c.wait {
+				t.Fatalf("restarted after %v, want at least %v", elapsed, c.wait)
+			}
+			if iceUfrag(t, sess.manager.PeerConnection) == ufrag {
+				t.Fatal("ICE credentials unchanged after restart")
+			}
+		})
+	}
+}
+
+func TestICEFailureTimeout(t *testing.T) {
+	cfg := config.Default()
+	cfg.ICE.RestartDelay = time.Minute
+	cfg.ICE.FailureTimeout = 100 * time.Millisecond
+	server, url := newTestServer(t, cfg)
+	conn := dialSignaling(t, url)
+	sess := server.lookupSession(readSessionInfo(t, conn).ResumeToken)
+
+	start := time.Now()
+	sess.ice.onStateChange(webrtc.ICEConnectionStateDisconnected)
+	// 跳过 ice_state 消息，直到连接被关闭
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var err error
+	for err == nil {
+		_, _, err = conn.ReadMessage()
+	}
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Text != "ice connection failed" {
+		t.Fatalf("read after failure timeout: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < cfg.ICE.FailureTimeout {
+		t.Fatalf("session closed after %v, want at least %v", elapsed, cfg.ICE.FailureTimeout)
+	}
+	select {
+	case <-sess.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("session not closed")
+	}
+}
+
+func TestICERestartNowAfterTimerFired(t *testing.T) {
+	var runs atomic.Int32
+	fired := make(chan struct{})
+	m := &iceMonitor{}
+	m.restart = time.AfterFunc(0, func() {
+		runs.Add(1)
+		close(fired)
+	})
+	<-fired
+	// 已触发的 restart 尚未清除 m.restart 时，再次请求不应重复触发
+	m.mu.Lock()
+	m.restartNow()
+	m.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	if n := runs.Load(); n != 1 {
+		t.Fatalf("restart ran %d times, want 1", n)
+	}
+}
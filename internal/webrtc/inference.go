@@ -0,0 +1,116 @@
+package webrtc
+
+import (
+	"context"
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/grpc"
+	"github.com/haowei703/webrtc-server/internal/recognition"
+	"time"
+)
+
+// InferenceSink 将帧发送给 gRPC 推理服务，并把去抖或聚合后的识别结果下发给客户端
+type InferenceSink struct {
+	client      *grpc.Client
+	filter      recognition.ResultFilter
+	aggregator  *recognition.Aggregator
+	emptyResult string
+	sendText    func(msg TextMessage) error
+	results     *FrameResults
+	// frameTime 当前帧的接收时间，作为过滤器的时钟
+	frameTime time.Time
+}
+
+// NewInferenceSink filters 为会话指定的过滤器，为空时使用配置中的过滤器；sentence 模式不使用过滤器
+func NewInferenceSink(client *grpc.Client, cfg config.RecognitionConfig, filters []config.FilterConfig, sendText func(msg TextMessage) error, results *FrameResults) *InferenceSink {
+	if len(filters) == 0 {
+		filters = cfg.Filters
+	}
+	if len(filters) == 0 {
+		filters = []config.FilterConfig{{Type: "dedup", Period: cfg.DebouncePeriod}}
+	}
+	s := &InferenceSink{
+		client:      client,
+		emptyResult: cfg.EmptyResult,
+		sendText:    sendText,
+		results:     results,
+	}
+	// 过滤器按帧的接收时间计时，离线回放时结果只取决于输入
+	s.filter = recognition.NewFilter(filters, func() time.Time { return s.frameTime })
+	if cfg.Mode == "sentence" {
+		s.aggregator = recognition.NewAggregator(cfg.Aggregator)
+	}
+	return s
+}
+
+func (s *InferenceSink) HandleFrame(ctx context.Context, frame *Frame) error {
+	// 通过grpc将视频字节传输给下游
+	result, err := s.client.SendMessage(ctx, grpc.Request{
+		SessionID:    frame.SessionID,
+		TrackID:      frame.TrackID,
+		VideoFrame:   frame.Data,
+		Width:        frame.Width,
+		Height:       frame.Height,
+		PixelFormat:  frame.PixelFormat,
+		Sequence:     frame.Sequence,
+		RTPTimestamp: frame.RTPTimestamp,
+		CapturedAt:   frame.ReceivedAt,
+		Model:        frame.Model,
+		Language:     frame.Language,
+	})
+	if err != nil {
+		return fmt.Errorf("inference: %w", err)
+	}
+	s.frameTime = frame.ReceivedAt
+	if s.results != nil {
+		s.results.Publish(frame.Sequence, result)
+	}
+	base := TextMessage{
+		LatencyMS: time.Since(frame.ReceivedAt).Milliseconds(),
+		Frame: &FrameRef{
+			TrackID:      frame.TrackID,
+			Sequence:     frame.Sequence,
+			RTPTimestamp: frame.RTPTimestamp,
+			TimestampMS:  frame.ReceivedAt.UnixMilli(),
+		},
+		Result: &result,
+	}
+
+	obs := recognition.Observation{Label: result.Label, Confidence: result.Confidence, At: frame.ReceivedAt}
+	if s.aggregator != nil {
+		if result.Label == s.emptyResult {
+			obs.Label = ""
+		}
+		return s.sendEvents(s.aggregator.Add(obs), base)
+	}
+
+	if s.filter.Accept(obs) && result.Label != s.emptyResult {
+		// 将处理结果回传给客户端，去抖模式下每个手语词都是最终结果
+		msg := base
+		msg.Message = result.Label
+		msg.Final = true
+		if err := s.sendText(msg); err != nil {
+			return fmt.Errorf("failed to send response: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *InferenceSink) sendEvents(events []recognition.Event, base TextMessage) error {
+	for _, e := range events {
+		msg := base
+		msg.Message, msg.Gloss, msg.Final = e.Sentence, e.Gloss, e.Final
+		if err := s.sendText(msg); err != nil {
+			return fmt.Errorf("failed to send response: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close 下发尚未结束的句子
+func (s *InferenceSink) Close() error {
+	if s.aggregator == nil {
+		return nil
+	}
+	return s.sendEvents(s.aggregator.Flush(), TextMessage{})
+}
@@ -0,0 +1,59 @@
+package webrtc
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
+	"time"
+)
+
+// configureConn 设置信令连接的消息大小上限与读超时，收到 pong 时延长读超时
+func (s *SignalingServer) configureConn(conn *websocket.Conn) {
+	pongWait := s.cfg.Signaling.PongWait
+	conn.SetReadLimit(s.cfg.Signaling.MaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+}
+
+// keepalive 定期向客户端发送 ping，直到 stop 关闭或发送失败
+func keepalive(conn *websocket.Conn, interval, writeWait time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// closeConn 发送关闭帧后关闭连接
+func closeConn(conn *websocket.Conn, code int, text string, writeWait time.Duration) {
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(writeWait))
+	_ = conn.Close()
+}
+
+// touch 记录会话的最近一次客户端活动
+func (sess *session) touch() {
+	sess.activity.Store(time.Now().UnixNano())
+}
+
+// idleFor 返回距最近一次客户端活动的时长，ICE 传输层收到新的数据也视为活动，仅由 supervise 调用
+func (sess *session) idleFor() time.Duration {
+	var received uint64
+	for _, stats := range sess.manager.PeerConnection.GetStats() {
+		if transport, ok := stats.(webrtc.TransportStats); ok {
+			received += transport.BytesReceived
+		}
+	}
+	if received != sess.bytesReceived {
+		sess.bytesReceived = received
+		sess.touch()
+	}
+	return time.Since(time.Unix(0, sess.activity.Load()))
+}
@@ -0,0 +1,68 @@
+package webrtc
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/ratelimit"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ErrorMessage 信令错误，以 type "error" 下发
+type ErrorMessage struct {
+	// Code server_busy、rate_limited、over_capacity、invalid_request 或 unauthorized
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// errUnknownToken ?token= 不在 limits.tokens 中
+var errUnknownToken = errors.New("unknown token")
+
+// clientIdentity 返回按身份限制使用的名称，已校验的客户端证书优先，其次为 ?token= 对应的身份
+func clientIdentity(r *http.Request, tokens []config.IdentityToken) (string, error) {
+	if name := clientCertName(r); name != "" {
+		return name, nil
+	}
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		return "", nil
+	}
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			return t.Name, nil
+		}
+	}
+	return "", errUnknownToken
+}
+
+// clientIP 返回请求的对端 IP
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// limitError 将限流错误转换为信令错误与 WebSocket 关闭码
+func limitError(err error) (ErrorMessage, int) {
+	if errors.Is(err, ratelimit.ErrServerBusy) {
+		return ErrorMessage{Code: "server_busy", Message: err.Error()}, websocket.CloseTryAgainLater
+	}
+	return ErrorMessage{Code: "rate_limited", Message: err.Error()}, websocket.ClosePolicyViolation
+}
+
+// rejectConn 下发信令错误后以 code 关闭连接
+func rejectConn(conn *websocket.Conn, msg ErrorMessage, code int, writeWait time.Duration) {
+	if data, err := json.Marshal(msg); err == nil {
+		if raw, err := json.Marshal(Message{Type: "error", Data: data}); err == nil {
+			_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+			_ = conn.WriteMessage(websocket.TextMessage, raw)
+		}
+	}
+	closeConn(conn, code, msg.Code, writeWait)
+}
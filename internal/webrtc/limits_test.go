@@ -0,0 +1,41 @@
+package webrtc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIdentity(t *testing.T) {
+	tokens := []config.IdentityToken{{Name: "web", Token: "t-web"}, {Name: "app", Token: "t-app"}}
+	tests := []struct {
+		name    string
+		query   string
+		cert    string
+		want    string
+		wantErr error
+	}{
+		{"anonymous", "", "", "", nil},
+		{"token", "?token=t-app", "", "app", nil},
+		{"unknown token", "?token=guess", "", "", errUnknownToken},
+		{"cert wins over token", "?token=t-web", "svc", "svc", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ws"+tt.query, nil)
+			if tt.cert != "" {
+				cert := &x509.Certificate{Subject: pkix.Name{CommonName: tt.cert}}
+				req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+			}
+			got, err := clientIdentity(req, tokens)
+			if got != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("clientIdentity = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
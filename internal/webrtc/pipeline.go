@@ -0,0 +1,171 @@
+package webrtc
+
+import (
+	"context"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/keyframe"
+	"github.com/pion/rtp"
+	"log/slog"
+	"time"
+)
+
+// TrackPipeline 将一个视频轨道的 RTP 包解包、解码为 Frame 并交给 FrameSink，实时会话与离线回放共用
+type TrackPipeline struct {
+	decoder     *VideoDecoder
+	sink        FrameSink
+	sessionID   string
+	trackID     string
+	ssrc        uint32
+	codec       string
+	pixelFormat string
+	sequence    uint64
+	logger      *slog.Logger
+	// width、height 最近一帧解码后（裁剪前）的分辨率
+	width, height int
+	// received 收齐的帧数，包括容量不足时未解码的帧
+	received uint64
+	gate     keyFrameGate
+
+	control   *SessionControl
+	send      func(msgType string, data any) error
+	snapshots uint64
+	// next 按目标帧率下一帧可以交给 sink 的时间
+	next time.Time
+}
+
+// NewTrackPipeline 创建解码流水线，codec 为 VP8、VP9、H264 或 H265
+func NewTrackPipeline(codec string, ssrc uint32, cfg config.DecoderConfig, sink FrameSink, sc SinkContext) (*TrackPipeline, error) {
+	decoder, err := NewVideoDecoder(codec, cfg, sc.Logger)
+	if err != nil {
+		return nil, err
+	}
+	p := &TrackPipeline{
+		decoder:     decoder,
+		sink:        sink,
+		sessionID:   sc.SessionID,
+		trackID:     sc.TrackID,
+		ssrc:        ssrc,
+		codec:       codec,
+		pixelFormat: cfg.PixelFormat,
+		logger:      sc.Logger,
+		control:     sc.Control,
+		send:        sc.Send,
+		gate:        keyFrameGate{request: sc.RequestKeyFrame},
+	}
+	// H265 按 RTP 包逐个送入解码器，无法按帧判断关键帧
+	if codec != "H265" {
+		p.gate.isKeyFrame = keyframe.For(codec)
+	}
+	return p, nil
+}
+
+// WriteRTP 处理一个 RTP 包，收齐一帧并解码成功后按会话的控制状态裁剪、抽帧后交给 sink，
+// 返回 sink 的错误。receivedAt 为包的到达时间，回放时传入抓包时间以保证结果可复现
+func (p *TrackPipeline) WriteRTP(ctx context.Context, packet *rtp.Packet, receivedAt time.Time) error {
+	encoded, err := p.decoder.assemble(packet)
+	if err != nil {
+		p.logger.Debug("error processing RTP packet", "error", err, "seq", packet.SequenceNumber)
+	}
+	// 视频帧不完整时等待后续的包
+	if encoded == nil {
+		return nil
+	}
+	p.received++
+	if !p.gate.admit(encoded, receivedAt) {
+		return nil
+	}
+	data, width, height, err := p.decoder.decode(encoded)
+	if err != nil {
+		p.logger.Debug("error decoding frame", "error", err, "seq", packet.SequenceNumber)
+	}
+	if data == nil {
+		return nil
+	}
+
+	p.sequence++
+	p.width, p.height = width, height
+	frame := &Frame{
+		SessionID:    p.sessionID,
+		TrackID:      p.trackID,
+		SSRC:         p.ssrc,
+		Codec:        p.codec,
+		Sequence:     p.sequence,
+		RTPTimestamp: packet.Timestamp,
+		ReceivedAt:   receivedAt,
+		Width:        width,
+		Height:       height,
+		PixelFormat:  p.pixelFormat,
+		Data:         data,
+	}
+
+	// 暂停时仍然解码，保证恢复后参考帧完整
+	state := p.control.state()
+	frame.Language, frame.Model = state.language, state.model
+	if state.roi != nil {
+		cropped, err := cropFrame(frame, *state.roi)
+		if err != nil {
+			p.logger.Debug("failed to crop frame", "error", err)
+		} else {
+			frame = cropped
+		}
+	}
+	if state.snapshots > p.snapshots {
+		p.snapshots = state.snapshots
+		p.sendSnapshot(frame)
+	}
+	if state.paused || !p.due(receivedAt, state.interval) {
+		return nil
+	}
+	return p.sink.HandleFrame(ctx, frame)
+}
+
+// due 按目标帧率判断该帧是否交给 sink，interval 为 0 表示不限制
+func (p *TrackPipeline) due(receivedAt time.Time, interval time.Duration) bool {
+	if interval <= 0 {
+		p.next = time.Time{}
+		return true
+	}
+	if receivedAt.Before(p.next) {
+		return false
+	}
+	// 按固定间隔推进，避免到达时间的抖动降低实际帧率；落后超过一个间隔时重新对齐
+	p.next = p.next.Add(interval)
+	if receivedAt.Sub(p.next) > interval {
+		p.next = receivedAt.Add(interval)
+	}
+	return true
+}
+
+func (p *TrackPipeline) sendSnapshot(frame *Frame) {
+	if p.send == nil {
+		return
+	}
+	snapshot, err := newSnapshot(frame)
+	if err == nil {
+		err = p.send("snapshot", snapshot)
+	}
+	if err != nil {
+		p.logger.Warn("failed to send snapshot", "error", err)
+	}
+}
+
+// SetKeyFrameInterval 解码容量不足时只解码关键帧，并按 interval 向发送端请求关键帧；0 表示恢复解码全部帧，
+// 恢复后从下一个关键帧开始解码。H265 不支持，始终解码全部帧
+func (p *TrackPipeline) SetKeyFrameInterval(interval time.Duration) {
+	p.gate.setInterval(interval)
+}
+
+// Resolution 返回最近一帧解码后的分辨率，尚未解码出帧时为 0
+func (p *TrackPipeline) Resolution() (int, int) {
+	return p.width, p.height
+}
+
+// Sequence 返回已解码的帧数
+func (p *TrackPipeline) Sequence() uint64 {
+	return p.sequence
+}
+
+// Received 返回收齐的帧数，包括未解码的帧
+func (p *TrackPipeline) Received() uint64 {
+	return p.received
+}
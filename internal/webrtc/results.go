@@ -0,0 +1,93 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"github.com/pion/webrtc/v3"
+	"log/slog"
+	"sync"
+)
+
+// resultChannel 下发识别结果的通道，客户端打开约定标签的 DataChannel 后优先使用，
+// 否则回退到信令 WebSocket；DataChannel 与媒体共用连接，不受信令断开影响
+type resultChannel struct {
+	label  string
+	logger *slog.Logger
+	ws     func(data []byte) error
+
+	mu       sync.Mutex
+	dc       *webrtc.DataChannel
+	dcClosed chan struct{}
+}
+
+func newResultChannel(label string, ws func(data []byte) error, logger *slog.Logger) *resultChannel {
+	return &resultChannel{label: label, ws: ws, logger: logger}
+}
+
+// accept 处理客户端打开的 DataChannel，只接受标签匹配且可靠有序的通道，
+// 通道上收到的消息交给 onMessage，例如控制命令
+func (r *resultChannel) accept(dc *webrtc.DataChannel, onMessage func(msg Message)) bool {
+	if r.label == "" || dc.Label() != r.label {
+		return false
+	}
+	if !dc.Ordered() || dc.MaxRetransmits() != nil || dc.MaxPacketLifeTime() != nil {
+		r.logger.Warn("ignoring unreliable data channel for results", "label", dc.Label())
+		return false
+	}
+	closed := make(chan struct{})
+	dc.OnOpen(func() {
+		r.mu.Lock()
+		r.dc, r.dcClosed = dc, closed
+		r.mu.Unlock()
+		r.logger.Info("results switched to data channel", "label", dc.Label())
+	})
+	dc.OnMessage(func(m webrtc.DataChannelMessage) {
+		var msg Message
+		if err := json.Unmarshal(m.Data, &msg); err != nil {
+			r.logger.Warn("unmarshal data channel message error", "error", err)
+			return
+		}
+		onMessage(msg)
+	})
+	dc.OnClose(func() {
+		r.mu.Lock()
+		if r.dc == dc {
+			r.dc = nil
+		}
+		r.mu.Unlock()
+		close(closed)
+		r.logger.Info("results data channel closed", "label", dc.Label())
+	})
+	return true
+}
+
+// dataChannelClosed 返回当前 DataChannel 关闭时关闭的 channel，没有打开的 DataChannel 时返回 nil
+func (r *resultChannel) dataChannelClosed() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dc == nil {
+		return nil
+	}
+	return r.dcClosed
+}
+
+// send 以信令消息的格式发送，DataChannel 与 WebSocket 上的消息格式相同
+func (r *resultChannel) send(msgType string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	msg, err := json.Marshal(Message{Type: msgType, Data: raw})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	dc := r.dc
+	r.mu.Unlock()
+	if dc != nil {
+		if err := dc.SendText(string(msg)); err == nil {
+			return nil
+		}
+	}
+	return r.ws(msg)
+}
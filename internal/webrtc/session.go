@@ -0,0 +1,518 @@
+package webrtc
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/logging"
+	"github.com/haowei703/webrtc-server/internal/ratelimit"
+	"github.com/haowei703/webrtc-server/internal/recording"
+	"github.com/pion/webrtc/v3"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errNotAttached 会话当前没有连接的信令 WebSocket
+var errNotAttached = errors.New("signaling not attached")
+
+// errShuttingDown 服务正在退出，不再创建新会话
+var errShuttingDown = errors.New("server shutting down")
+
+// errFiltersUnsupported 会话指定的 ?filters= 只在 debounce 模式下生效
+var errFiltersUnsupported = errors.New("filters are not supported in sentence mode")
+
+// SessionInfo 会话建立或恢复后以 type "session" 下发，客户端凭 ResumeToken 重连信令恢复会话
+type SessionInfo struct {
+	SessionID   string `json:"session_id"`
+	ResumeToken string `json:"resume_token"`
+	// ResumeGraceMS 信令断开后会话保留的时长
+	ResumeGraceMS int64 `json:"resume_grace_ms"`
+	Resumed       bool  `json:"resumed"`
+}
+
+// sessionParams 客户端在建立会话时通过 query 指定的参数
+type sessionParams struct {
+	sinkNames []string
+	consent   []string
+	filters   []config.FilterConfig
+	// video 客户端通过 ?video= 声明的发送规格，用于估算解码成本
+	video config.StreamSpec
+	// lease 会话占用的限流配额，会话结束时释放
+	lease *ratelimit.Lease
+}
+
+// session 一个媒体会话，生命周期独立于信令 WebSocket：信令断开后在宽限期内可凭 resume token 重新连接
+type session struct {
+	id       string
+	server   *SignalingServer
+	logger   *slog.Logger
+	params   sessionParams
+	manager  *RtcManager
+	recorder *recording.SessionRecorder
+	results  *resultChannel
+	control  *SessionControl
+	ice      *iceMonitor
+	rate     *rateController
+
+	// mu 保护 conn 与 closed，并串行化 WebSocket 写入
+	mu     sync.Mutex
+	conn   *websocket.Conn
+	closed bool
+
+	// token 由 server.mu 保护
+	token string
+
+	// activity 最近一次客户端活动的 Unix 纳秒时间，bytesReceived 仅由 supervise 访问
+	activity      atomic.Int64
+	bytesReceived uint64
+
+	attachments chan bool
+	pcDone      chan struct{}
+	pcDoneOnce  sync.Once
+	done        chan struct{}
+}
+
+func (s *SignalingServer) newSession(params sessionParams, logger *slog.Logger, id string) (*session, error) {
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		return nil, errShuttingDown
+	}
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	control := &SessionControl{}
+	rate := s.newRateController(control, logger)
+	manager, err := NewWebRTCManager(s.cfg, logger, rate)
+	if err != nil {
+		s.wg.Done()
+		return nil, err
+	}
+	sess := &session{
+		id:          id,
+		server:      s,
+		logger:      logger,
+		params:      params,
+		manager:     manager,
+		control:     control,
+		rate:        rate,
+		attachments: make(chan bool),
+		pcDone:      make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	sess.touch()
+	if s.cfg.Recording.Enabled {
+		sess.recorder, err = recording.NewSessionRecorder(s.cfg.Recording, id, logger)
+		if err != nil {
+			logger.Error("failed to start recording", "error", err)
+			sess.recorder = nil
+		}
+	}
+	sess.ice = newICEMonitor(sess, s.cfg.ICE.RestartDelay, s.cfg.ICE.FailureTimeout)
+	sess.results = newResultChannel(s.cfg.Signaling.DataChannel, func(data []byte) error {
+		return sess.write(websocket.TextMessage, data)
+	}, logger)
+
+	pc := manager.PeerConnection
+	// failed 可通过 ICE restart 恢复，由 iceMonitor 决定何时结束会话
+	pc.OnICEConnectionStateChange(sess.ice.onStateChange)
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateClosed {
+			sess.pcDoneOnce.Do(func() { close(sess.pcDone) })
+		}
+	})
+	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		if !sess.results.accept(dc, func(msg Message) {
+			sess.touch()
+			if !sess.params.lease.AllowMessage() {
+				logger.Debug("data channel message dropped by rate limit", "type", msg.Type)
+				return
+			}
+			sess.handleMessage(msg)
+		}) {
+			logger.Debug("ignoring data channel", "label", dc.Label())
+		}
+	})
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+		if err := sess.send("candidate", candidate.ToJSON()); err != nil {
+			logger.Warn("failed to send ICE candidate", "error", err)
+		}
+	})
+	pc.OnTrack(sess.handleTrack)
+
+	s.mu.Lock()
+	sess.token = newResumeToken()
+	s.sessions[sess.token] = sess
+	token := sess.token
+	s.mu.Unlock()
+	s.cluster.announce(id, token)
+	return sess, nil
+}
+
+func newResumeToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// lookupSession 按 resume token 查找会话
+func (s *SignalingServer) lookupSession(token string) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[token]
+}
+
+// rotateToken 恢复成功后更换 resume token，旧 token 随即失效
+func (s *SignalingServer) rotateToken(sess *session) string {
+	s.mu.Lock()
+	old := sess.token
+	if s.sessions[old] == sess {
+		delete(s.sessions, old)
+	}
+	sess.token = newResumeToken()
+	s.sessions[sess.token] = sess
+	token := sess.token
+	s.mu.Unlock()
+	s.cluster.withdraw(tokenKey(old))
+	s.cluster.announce(sess.id, token)
+	return token
+}
+
+// activeSessionIDs 返回尚未结束的会话，包括信令断开等待恢复的会话
+func (s *SignalingServer) activeSessionIDs() map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make(map[string]bool, len(s.sessions))
+	for _, sess := range s.sessions {
+		ids[sess.id] = true
+	}
+	return ids
+}
+
+func (s *SignalingServer) removeSession(sess *session) {
+	s.mu.Lock()
+	token := sess.token
+	if s.sessions[token] == sess {
+		delete(s.sessions, token)
+	}
+	s.mu.Unlock()
+	s.cluster.withdraw(tokenKey(token), sessionKey(sess.id))
+}
+
+// attach 将 WebSocket 连接绑定到会话，已有的连接会被关闭，会话已结束时返回 false
+func (sess *session) attach(conn *websocket.Conn) bool {
+	sess.mu.Lock()
+	if sess.closed {
+		sess.mu.Unlock()
+		return false
+	}
+	old := sess.conn
+	sess.conn = conn
+	sess.mu.Unlock()
+	if old != nil {
+		sess.logger.Info("signaling connection replaced")
+		closeConn(old, websocket.CloseGoingAway, "replaced by resumed connection", sess.server.cfg.Signaling.WriteWait)
+	}
+	select {
+	case sess.attachments <- true:
+	case <-sess.done:
+	}
+	return true
+}
+
+// detach 信令连接断开，conn 已被新的连接替换时忽略
+func (sess *session) detach(conn *websocket.Conn) {
+	sess.mu.Lock()
+	if sess.conn != conn {
+		sess.mu.Unlock()
+		return
+	}
+	sess.conn = nil
+	sess.mu.Unlock()
+	select {
+	case sess.attachments <- false:
+	case <-sess.done:
+	}
+}
+
+// attached 信令 WebSocket 是否处于连接状态
+func (sess *session) attached() bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.conn != nil
+}
+
+func (sess *session) write(messageType int, data []byte) error {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.conn == nil {
+		return errNotAttached
+	}
+	if err := sess.conn.SetWriteDeadline(time.Now().Add(sess.server.cfg.Signaling.WriteWait)); err != nil {
+		return err
+	}
+	return sess.conn.WriteMessage(messageType, data)
+}
+
+// send 通过信令 WebSocket 发送消息
+func (sess *session) send(msgType string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	msg, err := json.Marshal(Message{Type: msgType, Data: raw})
+	if err != nil {
+		return err
+	}
+	return sess.write(websocket.TextMessage, msg)
+}
+
+// sendInfo 下发会话信息与当前的 resume token
+func (sess *session) sendInfo(token string, resumed bool) error {
+	return sess.send("session", SessionInfo{
+		SessionID:     sess.id,
+		ResumeToken:   token,
+		ResumeGraceMS: sess.server.cfg.Signaling.ResumeGrace.Milliseconds(),
+		Resumed:       resumed,
+	})
+}
+
+// supervise 管理会话的生命周期：信令断开超过宽限期且没有打开的 DataChannel，
+// PeerConnection 关闭，ICE 在 failure_timeout 内未恢复，或空闲超过 idle_timeout 时结束会话
+func (sess *session) supervise(cfg config.SignalingConfig) {
+	grace := cfg.ResumeGrace
+	code, reason := websocket.CloseGoingAway, "session closed"
+	defer func() { sess.close(code, reason) }()
+	var idleCheck <-chan time.Time
+	if cfg.IdleTimeout > 0 {
+		ticker := time.NewTicker(cfg.IdleTimeout / 4)
+		defer ticker.Stop()
+		idleCheck = ticker.C
+	}
+	var timer *time.Timer
+	var expired <-chan time.Time
+	var dcClosed <-chan struct{}
+	stopTimer := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, expired = nil, nil
+		}
+	}
+	defer stopTimer()
+
+	for {
+		select {
+		case <-sess.pcDone:
+			sess.logger.Info("peer connection ended")
+			code, reason = websocket.CloseNormalClosure, "peer connection closed"
+			return
+		case <-sess.ice.failed:
+			reason = "ice connection failed"
+			return
+		case <-sess.server.shutdown:
+			reason = "server shutting down"
+			return
+		case <-idleCheck:
+			if idle := sess.idleFor(); idle >= cfg.IdleTimeout {
+				sess.logger.Info("session idle", "idle", idle)
+				reason = "idle timeout"
+				return
+			}
+		case attached := <-sess.attachments:
+			stopTimer()
+			dcClosed = nil
+			if !attached {
+				sess.logger.Info("signaling detached, waiting for resume", "grace", grace)
+				timer = time.NewTimer(grace)
+				expired = timer.C
+			}
+		case <-expired:
+			timer, expired = nil, nil
+			// 结果已改由 DataChannel 下发时，会话保持到 DataChannel 关闭
+			if dcClosed = sess.results.dataChannelClosed(); dcClosed == nil {
+				sess.logger.Info("resume grace period expired")
+				return
+			}
+			sess.logger.Info("signaling closed, session continues on data channel")
+		case <-dcClosed:
+			sess.logger.Info("data channel closed without signaling")
+			return
+		}
+	}
+}
+
+// close 结束会话，信令仍连接时以 code 关闭 WebSocket
+func (sess *session) close(code int, reason string) {
+	sess.mu.Lock()
+	sess.closed = true
+	conn := sess.conn
+	sess.conn = nil
+	sess.mu.Unlock()
+	close(sess.done)
+	sess.server.removeSession(sess)
+	sess.ice.stop()
+
+	if conn != nil {
+		closeConn(conn, code, reason, sess.server.cfg.Signaling.WriteWait)
+	}
+	if err := sess.manager.Close(); err != nil {
+		sess.logger.Warn("failed to close peer connection", "error", err)
+	}
+	sess.server.inference.ReleaseSession(sess.id)
+	sess.params.lease.Release()
+	if sess.recorder != nil {
+		if err := sess.recorder.Close(); err != nil {
+			sess.logger.Warn("failed to close recording", "error", err)
+		}
+	}
+	sess.logger.Info("session closed")
+	sess.server.wg.Done()
+}
+
+// serve 读取信令消息直到连接断开
+func (sess *session) serve(conn *websocket.Conn) {
+	cfg := sess.server.cfg.Signaling
+	sess.server.configureConn(conn)
+	stop := make(chan struct{})
+	go keepalive(conn, cfg.PingInterval, cfg.WriteWait, stop)
+	defer close(stop)
+	defer sess.detach(conn)
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			sess.logger.Info("read error", "error", err)
+			return
+		}
+		sess.touch()
+		_ = conn.SetReadDeadline(time.Now().Add(cfg.PongWait))
+		if !sess.params.lease.AllowMessage() {
+			sess.logger.Warn("signaling message rate exceeded")
+			sess.detach(conn)
+			rejectConn(conn, ErrorMessage{Code: "rate_limited", Message: "message rate exceeded"}, websocket.ClosePolicyViolation, cfg.WriteWait)
+			return
+		}
+
+		var msg Message
+		if err := json.Unmarshal(message, &msg); err != nil {
+			sess.logger.Warn("unmarshal error", "error", err, "message", string(message))
+			continue
+		}
+
+		switch msg.Type {
+		case "offer":
+			// 会话恢复后客户端可以发送 ICE restart 的 offer 重新协商
+			var offer webrtc.SessionDescription
+			if err := json.Unmarshal(msg.Data, &offer); err != nil {
+				sess.logger.Warn("unmarshal offer error", "error", err, "data", string(msg.Data))
+				continue
+			}
+			answer, err := sess.manager.HandleOffer(offer)
+			if err != nil {
+				sess.logger.Warn("HandleOffer error", "error", err)
+				continue
+			}
+			if err := sess.send("answer", answer); err != nil {
+				sess.logger.Warn("failed to send answer", "error", err)
+			}
+		case "answer":
+			sess.handleAnswer(msg.Data)
+		case "candidate":
+			var candidate webrtc.ICECandidateInit
+			if err := json.Unmarshal(msg.Data, &candidate); err != nil {
+				sess.logger.Warn("unmarshal candidate error", "error", err, "data", string(msg.Data))
+				continue
+			}
+			if err := sess.manager.AddICECandidate(candidate); err != nil {
+				sess.logger.Warn("AddICECandidate error", "error", err)
+			}
+		default:
+			sess.handleMessage(msg)
+		}
+	}
+}
+
+// handleMessage 处理经 WebSocket 或 DataChannel 收到的其他消息
+func (sess *session) handleMessage(msg Message) {
+	if msg.Type != "control" {
+		sess.logger.Debug("ignoring message", "type", msg.Type)
+		return
+	}
+	result := handleControl(sess.control, msg.Data)
+	sess.logger.Info("control message", "action", result.Action, "error", result.Error)
+	if err := sess.results.send("control_result", result); err != nil {
+		sess.logger.Warn("failed to send control result", "error", err)
+	}
+}
+
+// sendText 将识别结果以 text 消息回传给客户端
+func (sess *session) sendText(text TextMessage) error {
+	if sess.recorder != nil && text.Final {
+		sess.recorder.WriteResult(text.Message)
+	}
+	return sess.results.send("text", text)
+}
+
+func (sess *session) handleTrack(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+	trackLogger := sess.logger.With(logging.KeyTrack, track.ID(), logging.KeySSRC, uint32(track.SSRC()))
+	trackLogger.Info("got remote track", "kind", track.Kind().String(), "mime_type", track.Codec().MimeType)
+	pc := sess.manager.PeerConnection
+	requestKeyFrame := keyFrameRequester(pc, track, trackLogger)
+	trackRecorder := newTrackRecorder(sess.recorder, track, requestKeyFrame, trackLogger)
+	defer closeTrackRecorder(trackRecorder, trackLogger)
+	switch track.Kind() {
+	case webrtc.RTPCodecTypeAudio:
+		recordTrack(track, trackRecorder)
+	case webrtc.RTPCodecTypeVideo:
+		spec := announcedSpec(sess.params.video, negotiatedSpec(pc.RemoteDescription(), receiverMid(pc, receiver)))
+		sess.server.handleVideoTrack(sess.rate, track, spec, trackRecorder, sess.params.sinkNames, SinkContext{
+			SessionID: sess.id,
+			TrackID:   track.ID(),
+			Logger:    trackLogger,
+			SendText:  sess.sendText,
+			Send:      sess.results.send,
+			Control:   sess.control,
+			Consent:   sess.params.consent,
+			Filters:   sess.params.filters,
+			Results:   &FrameResults{},
+
+			RequestKeyFrame: requestKeyFrame,
+		})
+	}
+}
+
+// resumeSession 凭 resume token 将新的 WebSocket 连接绑定到已有会话
+func (s *SignalingServer) resumeSession(w http.ResponseWriter, r *http.Request, token string) {
+	sess := s.lookupSession(token)
+	if sess == nil {
+		// 多实例部署时会话可能位于其他实例
+		if !s.cluster.forward(w, r, tokenKey(token)) {
+			http.Error(w, "unknown or expired resume token", http.StatusNotFound)
+		}
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		sess.logger.Warn("failed to upgrade", "error", err)
+		return
+	}
+	if !sess.attach(conn) {
+		closeConn(conn, websocket.CloseGoingAway, "session closed", s.cfg.Signaling.WriteWait)
+		return
+	}
+	sess.logger.Info("session resumed", "remote_addr", r.RemoteAddr)
+	if err := sess.sendInfo(s.rotateToken(sess), true); err != nil {
+		sess.logger.Warn("failed to send session info", "error", err)
+	}
+	// 信令断开期间 ICE 未恢复时，恢复后立即发起 ICE restart
+	sess.ice.onAttach()
+	sess.serve(conn)
+}
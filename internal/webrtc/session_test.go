@@ -0,0 +1,140 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/grpc"
+	"github.com/haowei703/webrtc-server/internal/grpc/grpctest"
+	"github.com/pion/webrtc/v3"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer 启动只用于信令的服务端，返回 WebSocket 地址
+func newTestServer(t *testing.T, cfg *config.Config) (*SignalingServer, string) {
+	t.Helper()
+	mock := grpctest.NewServer()
+	t.Cleanup(mock.Close)
+	cfg.ICE.Servers = nil
+	cfg.Inference.Endpoints = []string{mock.Target()}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	inference, err := grpc.NewClient(cfg.Inference, logger, mock.DialOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { inference.Close() })
+	server, err := NewSignalingServer(cfg, logger, inference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(ts.Close)
+	return server, "ws" + strings.TrimPrefix(ts.URL, "http") + cfg.Signaling.Path
+}
+
+func dialSignaling(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readSessionInfo 读取连接后服务端下发的 session 消息
+func readSessionInfo(t *testing.T, conn *websocket.Conn) SessionInfo {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg Message
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "session" {
+		t.Fatalf("first message = %q, want session", msg.Type)
+	}
+	var info SessionInfo
+	if err := json.Unmarshal(msg.Data, &info); err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+// dialRejected 期望以 token 恢复会话时握手被拒绝
+func dialRejected(t *testing.T, url, token string) {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial(url+"?resume="+token, nil)
+	if err == nil {
+		conn.Close()
+		t.Fatalf("resume with %q accepted", token)
+	}
+	if !errors.Is(err, websocket.ErrBadHandshake) || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("resume with %q: %v, want %d", token, err, http.StatusNotFound)
+	}
+}
+
+func TestResumeWithinGrace(t *testing.T) {
+	cfg := config.Default()
+	cfg.Signaling.ResumeGrace = 5 * time.Second
+	server, url := newTestServer(t, cfg)
+
+	conn := dialSignaling(t, url)
+	first := readSessionInfo(t, conn)
+	if first.Resumed || first.ResumeToken == "" {
+		t.Fatalf("unexpected session info %+v", first)
+	}
+	sess := server.lookupSession(first.ResumeToken)
+	conn.Close()
+
+	resumed := readSessionInfo(t, dialSignaling(t, url+"?resume="+first.ResumeToken))
+	if !resumed.Resumed || resumed.SessionID != first.SessionID {
+		t.Fatalf("resumed session info %+v, want session %s", resumed, first.SessionID)
+	}
+	if resumed.ResumeToken == first.ResumeToken {
+		t.Fatal("resume token not rotated")
+	}
+	if server.lookupSession(resumed.ResumeToken) != sess {
+		t.Fatal("rotated token does not refer to the same session")
+	}
+	// 旧 token 在恢复后失效
+	dialRejected(t, url, first.ResumeToken)
+}
+
+func TestResumeUnknownToken(t *testing.T) {
+	_, url := newTestServer(t, config.Default())
+	dialRejected(t, url, "unknown")
+}
+
+func TestResumeGraceExpires(t *testing.T) {
+	cfg := config.Default()
+	cfg.Signaling.ResumeGrace = 50 * time.Millisecond
+	server, url := newTestServer(t, cfg)
+
+	conn := dialSignaling(t, url)
+	info := readSessionInfo(t, conn)
+	pc := server.lookupSession(info.ResumeToken).manager.PeerConnection
+	conn.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		server.wg.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("session not closed after resume grace")
+	}
+	if state := pc.ConnectionState(); state != webrtc.PeerConnectionStateClosed {
+		t.Fatalf("peer connection state = %s, want closed", state)
+	}
+	dialRejected(t, url, info.ResumeToken)
+}
@@ -1,15 +1,33 @@
 package webrtc
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/haowei703/webrtc-server/internal/bitrate"
+	"github.com/haowei703/webrtc-server/internal/capacity"
+	"github.com/haowei703/webrtc-server/internal/config"
 	"github.com/haowei703/webrtc-server/internal/grpc"
+	"github.com/haowei703/webrtc-server/internal/logging"
+	"github.com/haowei703/webrtc-server/internal/ratelimit"
+	"github.com/haowei703/webrtc-server/internal/recognition"
+	"github.com/haowei703/webrtc-server/internal/recording"
+	"github.com/haowei703/webrtc-server/internal/tlsutil"
+	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v3"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
-	"os"
+	"net/url"
+	"runtime"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,200 +36,478 @@ type Message struct {
 	Data json.RawMessage `json:"data"`
 }
 
-type SignRecognition struct {
-	lastResult     string
-	lastTimestamp  time.Time
-	mutex          sync.Mutex
-	debouncePeriod time.Duration
+// TextMessage text 消息的内容，用于下发识别结果
+type TextMessage struct {
+	// Message 识别结果，sentence 模式下为当前句子的全部内容
+	Message string `json:"message"`
+	// Gloss sentence 模式下正在识别、尚未确认的手语词
+	Gloss string `json:"gloss,omitempty"`
+	// Final 为 false 时是中间结果，之后会被同一句子的新结果替换
+	Final bool `json:"final"`
+	// LatencyMS 服务端从收齐视频帧到得到识别结果的耗时，供压测工具统计
+	LatencyMS int64 `json:"latency_ms,omitempty"`
+	// Frame 产生该消息的视频帧，会话结束时补发的最终结果没有对应的帧
+	Frame *FrameRef `json:"frame,omitempty"`
+	// Result 该帧的完整识别结果，包括置信度、候选结果、检测框、关键点与模型版本
+	Result *grpc.Result `json:"result,omitempty"`
 }
 
-func NewSignRecognition(debouncePeriod time.Duration) *SignRecognition {
-	return &SignRecognition{
-		lastResult:     "",
-		lastTimestamp:  time.Now(),
-		debouncePeriod: debouncePeriod,
-	}
+// FrameRef 识别结果对应的视频帧
+type FrameRef struct {
+	TrackID      string `json:"track_id"`
+	Sequence     uint64 `json:"sequence"`
+	RTPTimestamp uint32 `json:"rtp_timestamp"`
+	// TimestampMS 服务端收齐该帧的 Unix 毫秒时间戳
+	TimestampMS int64 `json:"timestamp_ms"`
 }
 
-func (sr *SignRecognition) ProcessResult(result string) bool {
-	sr.mutex.Lock()
-	defer sr.mutex.Unlock()
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
 
-	now := time.Now()
+// SignalingServer 信令服务器，负责 WebSocket 信令与媒体会话
+type SignalingServer struct {
+	cfg           *config.Config
+	logger        *slog.Logger
+	inference     *grpc.Client
+	sinkFactories map[string]SinkFactory
+	pruner        datasetPruner
+	limiter       *ratelimit.Limiter
+	capacity      *capacity.Model
+	bitrate       *bitrate.Policy
+	cluster       *clusterNode
 
-	// 如果识别结果相同且时间间隔小于阈值，则忽略
-	if result == sr.lastResult && now.Sub(sr.lastTimestamp) < sr.debouncePeriod {
-		return false
-	}
+	mu sync.Mutex
+	// sessions 以 resume token 为键的会话
+	sessions map[string]*session
+	// draining 收到退出信号后不再创建新会话
+	draining bool
+	// wg 跟踪未结束的会话，shutdown 关闭时通知全部会话结束
+	wg       sync.WaitGroup
+	shutdown chan struct{}
 
-	// 否则处理新结果并更新缓存
-	sr.lastResult = result
-	sr.lastTimestamp = now
-	return true
+	listening atomic.Bool
 }
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+func NewSignalingServer(cfg *config.Config, logger *slog.Logger, inference *grpc.Client) (*SignalingServer, error) {
+	node, err := newClusterNode(cfg.Cluster, logger)
+	if err != nil {
+		return nil, err
+	}
+	s := &SignalingServer{
+		cfg:           cfg,
+		logger:        logger,
+		inference:     inference,
+		sinkFactories: make(map[string]SinkFactory),
+		sessions:      make(map[string]*session),
+		shutdown:      make(chan struct{}),
+		limiter:       ratelimit.NewLimiter(cfg.Limits),
+		capacity:      capacity.NewModel(cfg.Capacity, runtime.NumCPU()),
+		bitrate:       bitrate.NewPolicy(cfg.Bitrate),
+		cluster:       node,
+	}
+	s.RegisterSink("inference", func(sc SinkContext) (FrameSink, error) {
+		return NewInferenceSink(s.inference, s.cfg.Recognition, sc.Filters, sc.SendText, sc.Results), nil
+	})
+	s.RegisterSink("thumbnail", func(sc SinkContext) (FrameSink, error) {
+		return NewThumbnailSink(s.cfg.Sinks.Thumbnail, sc.SessionID, sc.TrackID)
+	})
+	s.RegisterSink("dataset", func(sc SinkContext) (FrameSink, error) {
+		if !slices.Contains(sc.Consent, consentDataset) {
+			sc.Logger.Info("dataset export skipped without client consent")
+			return nopSink{}, nil
+		}
+		s.pruner.prune(s.cfg.Sinks.Dataset, s.activeSessionIDs, s.logger)
+		return NewDatasetSink(s.cfg.Sinks.Dataset, sc)
+	})
+	return s, nil
 }
 
-func handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+func (s *SignalingServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if token := r.URL.Query().Get("resume"); token != "" {
+		s.resumeSession(w, r, token)
+		return
+	}
+
+	sessionID := uuid.NewString()
+	logger := s.logger.With(logging.KeySession, sessionID)
+
+	sinkNames, err := s.sessionSinks(r.URL.Query().Get("sinks"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	consent := parseConsent(r.URL.Query().Get("consent"))
+	filters, err := recognition.ParseFilters(r.URL.Query().Get("filters"))
 	if err != nil {
-		log.Println("Failed to upgrade:", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	video, err := parseVideoSpec(r.URL.Query().Get("video"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer conn.Close()
 
-	manager, err := NewWebRTCManager()
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Warn("failed to upgrade", "error", err)
+		return
+	}
+	if len(filters) > 0 && s.cfg.Recognition.Mode == "sentence" {
+		// sentence 模式下由聚合器按置信度投票确认手语词，逐帧过滤器会打乱投票
+		logger.Info("session rejected", "remote_addr", r.RemoteAddr, "error", errFiltersUnsupported)
+		rejectConn(conn, ErrorMessage{Code: "invalid_request", Message: errFiltersUnsupported.Error()}, websocket.ClosePolicyViolation, s.cfg.Signaling.WriteWait)
+		return
+	}
+	identity, err := clientIdentity(r, s.cfg.Limits.Tokens)
 	if err != nil {
-		log.Println("Failed to create RtcManager:", err)
+		logger.Warn("session rejected", "remote_addr", r.RemoteAddr, "error", err)
+		rejectConn(conn, ErrorMessage{Code: "unauthorized", Message: err.Error()}, websocket.ClosePolicyViolation, s.cfg.Signaling.WriteWait)
 		return
 	}
-	defer manager.Close()
+	lease, err := s.limiter.Admit(clientIP(r), identity)
+	if err != nil {
+		// 浏览器无法读取握手失败的 HTTP 状态码，升级后以信令错误拒绝
+		logger.Warn("session rejected", "remote_addr", r.RemoteAddr, "identity", identity, "error", err)
+		msg, code := limitError(err)
+		rejectConn(conn, msg, code, s.cfg.Signaling.WriteWait)
+		return
+	}
+	logger.Info("session started", "remote_addr", r.RemoteAddr, "identity", identity, "sinks", sinkNames, "consent", consent, "filters", r.URL.Query().Get("filters"), "video", r.URL.Query().Get("video"))
 
-	var mu sync.Mutex // 互斥锁，用于保护 WebSocket 连接
+	sess, err := s.newSession(sessionParams{sinkNames: sinkNames, consent: consent, filters: filters, video: video, lease: lease}, logger, sessionID)
+	if err != nil {
+		lease.Release()
+		if errors.Is(err, errShuttingDown) {
+			rejectConn(conn, ErrorMessage{Code: "server_busy", Message: err.Error()}, websocket.CloseGoingAway, s.cfg.Signaling.WriteWait)
+			return
+		}
+		logger.Error("failed to create RtcManager", "error", err)
+		closeConn(conn, websocket.CloseInternalServerErr, "failed to create session", s.cfg.Signaling.WriteWait)
+		return
+	}
+	sess.mu.Lock()
+	sess.conn = conn
+	sess.mu.Unlock()
+	go sess.supervise(s.cfg.Signaling)
 
-	writeMessage := func(messageType int, data []byte) error {
-		mu.Lock()
-		defer mu.Unlock()
-		return conn.WriteMessage(messageType, data)
+	s.mu.Lock()
+	token := sess.token
+	s.mu.Unlock()
+	if err := sess.sendInfo(token, false); err != nil {
+		logger.Warn("failed to send session info", "error", err)
 	}
+	sess.serve(conn)
+}
 
-	manager.PeerConnection.OnICECandidate(func(candidate *webrtc.ICECandidate) {
-		if candidate != nil {
-			jsonCandidate, _ := json.Marshal(candidate.ToJSON())
-			message := Message{Type: "candidate", Data: jsonCandidate}
-			jsonMessage, _ := json.Marshal(message)
-			if err := writeMessage(websocket.TextMessage, jsonMessage); err != nil {
-				log.Println("Failed to send ICE candidate:", err)
-			}
+// parseConsent 解析客户端给出的授权列表，例如 ?consent=dataset
+func parseConsent(query string) []string {
+	var consent []string
+	for _, c := range strings.Split(query, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			consent = append(consent, c)
 		}
-	})
+	}
+	return consent
+}
+
+// clientCertName 返回已校验的客户端证书名称，用于区分内部客户端
+func clientCertName(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
 
-	manager.PeerConnection.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
-		log.Printf("Got remote track: %s, type: %s\n", track.ID(), track.Kind())
-		switch track.Kind() {
-		case webrtc.RTPCodecTypeAudio:
-			handleAudioTrack(track)
-		case webrtc.RTPCodecTypeVideo:
-			handleVideoTrack(track, writeMessage)
+// keyFrameRequester 返回以 PLI 向发送端请求关键帧的函数
+func keyFrameRequester(pc *webrtc.PeerConnection, track *webrtc.TrackRemote, logger *slog.Logger) func() {
+	return func() {
+		pli := &rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())}
+		if err := pc.WriteRTCP([]rtcp.Packet{pli}); err != nil {
+			logger.Debug("failed to request key frame", "error", err)
 		}
+	}
+}
 
-		if err != nil {
-			log.Println("Failed to init video decoder:", err)
-			return
+// receiverMid 返回 receiver 所在 transceiver 的 mid
+func receiverMid(pc *webrtc.PeerConnection, receiver *webrtc.RTPReceiver) string {
+	for _, t := range pc.GetTransceivers() {
+		if t.Receiver() == receiver {
+			return t.Mid()
 		}
+	}
+	return ""
+}
 
+// newTrackRecorder 会话开启录制时为轨道创建录制，不录制时返回 nil
+func newTrackRecorder(recorder *recording.SessionRecorder, track *webrtc.TrackRemote, requestKeyFrame func(), logger *slog.Logger) *recording.TrackRecorder {
+	if recorder == nil {
+		return nil
+	}
+	codec := track.Codec()
+	rec, err := recorder.NewTrack(recording.TrackInfo{
+		ID:              track.ID(),
+		MimeType:        codec.MimeType,
+		ClockRate:       codec.ClockRate,
+		Channels:        codec.Channels,
+		RequestKeyFrame: requestKeyFrame,
 	})
+	if err != nil {
+		logger.Info("track not recorded", "error", err)
+		return nil
+	}
+	return rec
+}
+
+// closeTrackRecorder 轨道结束后关闭录制，rec 可为 nil
+func closeTrackRecorder(rec *recording.TrackRecorder, logger *slog.Logger) {
+	if rec == nil {
+		return
+	}
+	if err := rec.Close(); err != nil {
+		logger.Warn("failed to close recording", "error", err)
+	}
+}
 
+// recordTrack 只录制不解码的轨道：音频，或因解码容量不足被拒绝的视频
+func recordTrack(track *webrtc.TrackRemote, rec *recording.TrackRecorder) {
+	if rec == nil {
+		return
+	}
 	for {
-		_, message, err := conn.ReadMessage()
+		rtp, _, err := track.ReadRTP()
 		if err != nil {
-			log.Println("Read error:", err)
-			break
-		}
-
-		var msg Message
-		if err := json.Unmarshal(message, &msg); err != nil {
-			log.Println("Unmarshal error:", err)
-			log.Printf("Message: %s", message) // 打印原始消息进行调试
-			continue
+			return
 		}
-
-		switch msg.Type {
-		case "offer":
-			var offer webrtc.SessionDescription
-			if err := json.Unmarshal(msg.Data, &offer); err != nil {
-				log.Println("Unmarshal offer error:", err)
-				log.Printf("Data: %s", msg.Data) // 打印原始数据进行调试
-				continue
-			}
-			answer, err := manager.HandleOffer(offer)
-			if err != nil {
-				log.Println("HandleOffer error:", err)
-				continue
-			}
-			jsonAnswer, _ := json.Marshal(answer)
-			responseMsg := Message{Type: "answer", Data: json.RawMessage(jsonAnswer)}
-			jsonResponseMsg, _ := json.Marshal(responseMsg)
-			if err := writeMessage(websocket.TextMessage, jsonResponseMsg); err != nil {
-				log.Println("Failed to send answer:", err)
-			}
-		case "candidate":
-			var candidate webrtc.ICECandidateInit
-			if err := json.Unmarshal(msg.Data, &candidate); err != nil {
-				log.Println("Unmarshal candidate error:", err)
-				log.Printf("Data: %s", msg.Data) // 打印原始数据进行调试
-				continue
-			}
-			if err := manager.AddICECandidate(candidate); err != nil {
-				log.Println("AddICECandidate error:", err)
-			}
+		if err := rec.WriteRTP(rtp); err != nil {
+			return
 		}
 	}
 }
 
-func handleAudioTrack(track *webrtc.TrackRemote) {
-
-}
-
-func handleVideoTrack(track *webrtc.TrackRemote, writeMessage func(messageType int, data []byte) error) {
+// handleVideoTrack 按 spec 估算解码成本后接入、降级或拒绝轨道，spec 中为 0 的字段按默认规格估算；
+// rec 由调用方在轨道结束后关闭
+func (s *SignalingServer) handleVideoTrack(rate *rateController, track *webrtc.TrackRemote, spec config.StreamSpec, rec *recording.TrackRecorder, sinkNames []string, sc SinkContext) {
+	logger := sc.Logger
 	mimeType := track.Codec().MimeType
 	codec := strings.Split(mimeType, "/")[1]
-	vd, err := NewVideoDecoder(codec)
+	reservation, err := s.capacity.Admit(codec, spec)
+	if err != nil {
+		logger.Warn("track rejected", "error", err, "spec", spec, "capacity", s.capacity.Status())
+		if err := sc.Send("error", ErrorMessage{Code: "over_capacity", Message: err.Error()}); err != nil {
+			logger.Debug("failed to send error", "error", err)
+		}
+		recordTrack(track, rec)
+		return
+	}
+	defer reservation.Release()
+
+	sink, err := s.newTrackSink(sinkNames, sc)
 	if err != nil {
-		panic(err)
+		logger.Error("failed to create frame sinks", "error", err)
+		return
 	}
+	defer func() {
+		if err := sink.Close(); err != nil {
+			logger.Warn("failed to close frame sinks", "error", err)
+		}
+	}()
 
-	recognizer := NewSignRecognition(2 * time.Second)
+	pipeline, err := NewTrackPipeline(codec, uint32(track.SSRC()), s.cfg.Decoder, sink, sc)
+	if err != nil {
+		logger.Error("failed to init video decoder", "error", err)
+		return
+	}
+
+	tc := newTrackCapacity(s.capacity, reservation, rate, uint32(track.SSRC()), logger)
+	tc.apply(pipeline, reservation.Downgraded())
 
 	// 处理track
 	for {
 		rtp, _, readErr := track.ReadRTP()
 		if readErr != nil {
-			log.Println("ReadRTP error:", readErr)
+			logger.Info("ReadRTP error", "error", readErr)
 			return
 		}
+		if rec != nil {
+			if err := rec.WriteRTP(rtp); err != nil {
+				logger.Warn("recording failed, stop recording track", "error", err)
+				rec = nil
+			}
+		}
 
-		var rgbData []byte
-		var width, height int
+		now := time.Now()
+		if err := pipeline.WriteRTP(context.Background(), rtp, now); err != nil {
+			logger.Warn("frame sink error", "error", err, "frame", pipeline.Sequence())
+		}
+		tc.check(pipeline, now)
+	}
+}
+
+// Handler 返回信令服务的 HTTP 路由，可挂载到自定义的 http.Server 或 httptest.Server
+func (s *SignalingServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(s.cfg.Signaling.Path, s.handleWebSocket)
+	mux.HandleFunc("/admin/capacity", requireAdmin(s.cfg.Signaling.Admin, s.handleCapacity))
+	mux.HandleFunc("GET /admin/sessions/{id}", requireAdmin(s.cfg.Signaling.Admin, s.handleSessionStatus))
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	return mux
+}
+
+// ListenAndServe 按配置启动信令服务，配置了证书时使用 TLS；ctx 结束时停止证书热加载并优雅退出，
+// 退出完成后返回
+func (s *SignalingServer) ListenAndServe(ctx context.Context) error {
+	for _, name := range s.cfg.Sinks.Allowed {
+		if _, ok := s.sinkFactories[name]; !ok {
+			return fmt.Errorf("sinks.allowed: sink %s not registered", name)
+		}
+	}
 
-		rgbData, width, height, err = vd.processRTPPacket(rtp)
+	server := &http.Server{
+		Addr:     s.cfg.Signaling.Addr,
+		Handler:  s.Handler(),
+		ErrorLog: slog.NewLogLogger(s.logger.Handler(), slog.LevelWarn),
+	}
+
+	tlsCfg := s.cfg.Signaling.TLS
+	if tlsCfg.Enabled() {
+		tlsConfig, err := s.newTLSConfig(ctx)
 		if err != nil {
-			log.Println("error processing RTP packet:", err)
+			return err
 		}
+		// http.Server 会在 TLS 监听上自动启用 HTTP/2，WebSocket 升级仍走 HTTP/1.1
+		server.TLSConfig = tlsConfig
+	}
 
-		// 视频帧不完整时退出当前循环继续处理
-		if rgbData != nil {
-			// 通过grpc将视频字节传输给下游
-			response, err := grpc.SendMessage(rgbData, width, height)
-			if err != nil {
-				log.Println("gRPC error:", err)
-				return
-			}
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+	go s.refreshDirectory(ctx)
+	s.listening.Store(true)
+	s.logger.Info("WebSocket server started", "addr", server.Addr, "path", s.cfg.Signaling.Path, "tls", tlsCfg.Enabled())
+
+	errc := make(chan error, 1)
+	go func() {
+		if tlsCfg.Enabled() {
+			errc <- server.ServeTLS(ln, "", "")
+		} else {
+			errc <- server.Serve(ln)
+		}
+	}()
 
-			if recognizer.ProcessResult(response) && response != "result is None" {
-				data := map[string]string{"message": response}
-				jsonData, _ := json.Marshal(data)
-				// 将处理结果回传给客户端
-				msg := Message{Type: "text", Data: json.RawMessage(jsonData)}
-				jsonMsg, _ := json.Marshal(msg)
-				if err := writeMessage(websocket.TextMessage, jsonMsg); err != nil {
-					log.Println("Failed to send response:", err)
-				}
+	var redirect *http.Server
+	if tlsCfg.Enabled() && tlsCfg.RedirectAddr != "" {
+		redirect = &http.Server{
+			Addr:     tlsCfg.RedirectAddr,
+			Handler:  httpsRedirectHandler(server.Addr),
+			ErrorLog: server.ErrorLog,
+		}
+		go func() {
+			s.logger.Info("HTTP redirect server started", "addr", tlsCfg.RedirectAddr)
+			if err := redirect.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.logger.Error("HTTP redirect server stopped", "error", err)
 			}
+		}()
+	}
+
+	select {
+	case err := <-errc:
+		s.listening.Store(false)
+		if redirect != nil {
+			_ = redirect.Close()
 		}
+		return err
+	case <-ctx.Done():
+		return s.gracefulShutdown(server, redirect)
 	}
 }
 
-func StartWebSocketServer() {
-	http.HandleFunc("/ws/signaling", handleWebSocket)
-	port := os.Getenv("SIGNALING_PORT")
-	if port == "" {
-		port = "8081"
+// gracefulShutdown 先标记为未就绪并拒绝新会话，等待 ShutdownDelay 让负载均衡摘除节点，
+// 再停止监听（包括 HTTP 重定向服务，redirect 可为 nil）并关闭全部会话
+func (s *SignalingServer) gracefulShutdown(server, redirect *http.Server) error {
+	cfg := s.cfg.Signaling
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+	s.logger.Info("shutting down, marked not ready", "delay", cfg.ShutdownDelay)
+	time.Sleep(cfg.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	err := server.Shutdown(ctx)
+	if redirect != nil {
+		if rerr := redirect.Shutdown(ctx); err == nil {
+			err = rerr
+		}
+	}
+	s.listening.Store(false)
+	// WebSocket 连接已被接管，不受 server.Shutdown 影响，由各会话自行关闭
+	close(s.shutdown)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.logger.Info("all sessions closed")
+	case <-ctx.Done():
+		s.logger.Warn("sessions not closed before shutdown timeout", "timeout", cfg.ShutdownTimeout)
 	}
-	log.Printf("WebSocket server started at %s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	if s.cluster != nil {
+		_ = s.cluster.directory.Close()
+	}
+	return err
+}
+
+// newTLSConfig 创建支持证书热加载与可选 mTLS 的 TLS 配置
+func (s *SignalingServer) newTLSConfig(ctx context.Context) (*tls.Config, error) {
+	tlsCfg := s.cfg.Signaling.TLS
+	reloader, err := tlsutil.NewCertReloader(tlsCfg.CertFile, tlsCfg.KeyFile, s.logger)
+	if err != nil {
+		return nil, err
+	}
+	if tlsCfg.ReloadInterval > 0 {
+		go reloader.Watch(ctx, tlsCfg.ReloadInterval)
+	}
+
+	clientAuth, err := tlsutil.ParseClientAuth(tlsCfg.ClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+		ClientAuth:     clientAuth,
+	}
+	if tlsCfg.ClientCAFile != "" {
+		pool, err := tlsutil.LoadCertPool(tlsCfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// httpsRedirectHandler 将 HTTP 请求重定向到 tlsAddr 对应的 HTTPS 地址
+func httpsRedirectHandler(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
 }
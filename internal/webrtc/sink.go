@@ -0,0 +1,183 @@
+package webrtc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/grpc"
+	"image"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Frame 解码后的视频帧及其元数据，Data 在多个 FrameSink 间共享，只读
+type Frame struct {
+	SessionID    string
+	TrackID      string
+	SSRC         uint32
+	Codec        string
+	Sequence     uint64    // 轨道内的帧序号，从 1 开始
+	RTPTimestamp uint32    // 帧最后一个 RTP 包的时间戳
+	ReceivedAt   time.Time // 服务端收齐该帧的时间
+	Width        int
+	Height       int
+	PixelFormat  string // 与 decoder.pixel_format 一致：rgba 或 rgb24
+	Data         []byte
+	// Language 与 Model 为客户端通过控制命令选择的手语种类与模型，为空表示使用推理服务的默认值
+	Language string
+	Model    string
+}
+
+// Image 将帧数据转换为 image.Image
+func (f *Frame) Image() (image.Image, error) {
+	switch f.PixelFormat {
+	case "rgba":
+		if len(f.Data) < f.Width*f.Height*4 {
+			return nil, fmt.Errorf("rgba frame too short: %d bytes for %dx%d", len(f.Data), f.Width, f.Height)
+		}
+		return &image.RGBA{Pix: f.Data, Stride: f.Width * 4, Rect: image.Rect(0, 0, f.Width, f.Height)}, nil
+	case "rgb24":
+		if len(f.Data) < f.Width*f.Height*3 {
+			return nil, fmt.Errorf("rgb24 frame too short: %d bytes for %dx%d", len(f.Data), f.Width, f.Height)
+		}
+		img := image.NewRGBA(image.Rect(0, 0, f.Width, f.Height))
+		for i, j := 0, 0; i < f.Width*f.Height*3; i, j = i+3, j+4 {
+			img.Pix[j], img.Pix[j+1], img.Pix[j+2], img.Pix[j+3] = f.Data[i], f.Data[i+1], f.Data[i+2], 0xff
+		}
+		return img, nil
+	}
+	return nil, fmt.Errorf("pixel format %s not supported", f.PixelFormat)
+}
+
+// FrameSink 接收解码后的视频帧，每个视频轨道各自创建实例，HandleFrame 不会被并发调用
+type FrameSink interface {
+	HandleFrame(ctx context.Context, frame *Frame) error
+	Close() error
+}
+
+// SinkContext 创建 FrameSink 时可用的会话信息
+type SinkContext struct {
+	SessionID string
+	TrackID   string
+	Logger    *slog.Logger
+	// SendText 将识别结果下发给客户端
+	SendText func(msg TextMessage) error
+	// Send 以指定类型向客户端发送消息，例如 snapshot
+	Send func(msgType string, data any) error
+	// Control 会话的控制状态，为空表示不接受控制命令，例如离线回放
+	Control *SessionControl
+	// Consent 客户端通过 ?consent= 给出的授权，例如 dataset
+	Consent []string
+	// Filters 客户端通过 ?filters= 为本会话指定的结果过滤器，为空时使用服务端配置
+	Filters []config.FilterConfig
+	// Results 同一轨道内各 sink 共享的逐帧识别结果
+	Results *FrameResults
+	// RequestKeyFrame 向发送端请求关键帧，为空表示无法请求，例如离线回放
+	RequestKeyFrame func()
+}
+
+// FrameResults 在同一轨道的 sink 之间传递逐帧识别结果，由推理 sink 发布，其他 sink 订阅
+type FrameResults struct {
+	mu          sync.Mutex
+	subscribers []func(sequence uint64, result grpc.Result)
+}
+
+// Subscribe 注册回调，回调可能与 HandleFrame 并发执行
+func (r *FrameResults) Subscribe(fn func(sequence uint64, result grpc.Result)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// Publish 发布第 sequence 帧的识别结果，包括表示"无结果"的返回值
+func (r *FrameResults) Publish(sequence uint64, result grpc.Result) {
+	r.mu.Lock()
+	subscribers := r.subscribers
+	r.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(sequence, result)
+	}
+}
+
+// SinkFactory 为一个视频轨道创建 FrameSink
+type SinkFactory func(sc SinkContext) (FrameSink, error)
+
+// FanOutSink 将每一帧并发分发给多个 FrameSink，所有 sink 处理完后才处理下一帧
+type FanOutSink struct {
+	sinks []FrameSink
+}
+
+func NewFanOutSink(sinks ...FrameSink) *FanOutSink {
+	return &FanOutSink{sinks: sinks}
+}
+
+func (f *FanOutSink) HandleFrame(ctx context.Context, frame *Frame) error {
+	if len(f.sinks) == 1 {
+		return f.sinks[0].HandleFrame(ctx, frame)
+	}
+	errs := make([]error, len(f.sinks))
+	var wg sync.WaitGroup
+	for i, sink := range f.sinks {
+		wg.Add(1)
+		go func(i int, sink FrameSink) {
+			defer wg.Done()
+			errs[i] = sink.HandleFrame(ctx, frame)
+		}(i, sink)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (f *FanOutSink) Close() error {
+	var errs []error
+	for _, sink := range f.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// RegisterSink 注册自定义 FrameSink，名称需同时出现在 sinks.allowed 中才能被会话选用
+func (s *SignalingServer) RegisterSink(name string, factory SinkFactory) {
+	s.sinkFactories[name] = factory
+}
+
+// sessionSinks 解析客户端选择的 sink 列表，为空时使用默认配置
+func (s *SignalingServer) sessionSinks(query string) ([]string, error) {
+	if query == "" {
+		return s.cfg.Sinks.Default, nil
+	}
+	var names []string
+	for _, name := range strings.Split(query, ",") {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(s.cfg.Sinks.Allowed, name) {
+			return nil, fmt.Errorf("sink %q not allowed", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// newTrackSink 为视频轨道创建会话选择的全部 sink
+func (s *SignalingServer) newTrackSink(names []string, sc SinkContext) (FrameSink, error) {
+	var sinks []FrameSink
+	// 创建失败时关闭已创建的 sink
+	fail := func(err error) (FrameSink, error) {
+		return nil, errors.Join(err, NewFanOutSink(sinks...).Close())
+	}
+	for _, name := range names {
+		factory, ok := s.sinkFactories[name]
+		if !ok {
+			return fail(fmt.Errorf("sink %s not registered", name))
+		}
+		sink, err := factory(sc)
+		if err != nil {
+			return fail(fmt.Errorf("creating sink %s: %w", name, err))
+		}
+		sinks = append(sinks, sink)
+	}
+	return NewFanOutSink(sinks...), nil
+}
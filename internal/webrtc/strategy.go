@@ -17,16 +17,18 @@ type VP8PacketUnmarshaller struct {
 func (u *VP8PacketUnmarshaller) Unmarshal(packet *rtp.Packet) ([]byte, error) {
 	if u.vp8Packet == nil {
 		u.vp8Packet = &codecs.VP8Packet{}
+		u.frameBuffer = make(map[uint32][]byte)
+	}
+	payload, err := u.vp8Packet.Unmarshal(packet.Payload)
+	if err != nil {
+		return nil, err
 	}
 
-	var nalUnit []byte
-
-	// 将 NAL 单元数据添加到缓冲区中
-	if buf, ok := u.frameBuffer[packet.SSRC]; ok {
-		u.frameBuffer[packet.SSRC] = append(buf, nalUnit...)
-	} else {
-		u.frameBuffer[packet.SSRC] = nalUnit
+	// S 位表示新帧的第一个分片，丢弃之前未收齐的数据
+	if u.vp8Packet.S == 1 && u.vp8Packet.PID == 0 {
+		delete(u.frameBuffer, packet.SSRC)
 	}
+	u.frameBuffer[packet.SSRC] = append(u.frameBuffer[packet.SSRC], payload...)
 
 	// 检查 RTP 包的 Marker 位，Marker 位为 1 表示这是一个RTP序列的最后一个包
 	if packet.Marker {
@@ -34,16 +36,37 @@ func (u *VP8PacketUnmarshaller) Unmarshal(packet *rtp.Packet) ([]byte, error) {
 		delete(u.frameBuffer, packet.SSRC)
 		return frame, nil
 	}
-	return u.vp8Packet.Unmarshal(packet.Payload)
+	return nil, nil
 }
 
 type VP9PacketUnmarshaller struct {
 	frameBuffer map[uint32][]byte
+	vp9Packet   *codecs.VP9Packet
 }
 
 func (u *VP9PacketUnmarshaller) Unmarshal(packet *rtp.Packet) ([]byte, error) {
-	var vp9Packet codecs.VP9Packet
-	return vp9Packet.Unmarshal(packet.Payload)
+	if u.vp9Packet == nil {
+		u.vp9Packet = &codecs.VP9Packet{}
+		u.frameBuffer = make(map[uint32][]byte)
+	}
+	payload, err := u.vp9Packet.Unmarshal(packet.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// B 位表示帧的第一个分片，丢弃之前未收齐的数据
+	if u.vp9Packet.B {
+		delete(u.frameBuffer, packet.SSRC)
+	}
+	u.frameBuffer[packet.SSRC] = append(u.frameBuffer[packet.SSRC], payload...)
+
+	// 检查 RTP 包的 Marker 位，Marker 位为 1 表示这是一个RTP序列的最后一个包
+	if packet.Marker {
+		frame := u.frameBuffer[packet.SSRC]
+		delete(u.frameBuffer, packet.SSRC)
+		return frame, nil
+	}
+	return nil, nil
 }
 
 type H264PacketUnmarshaller struct {
@@ -0,0 +1,84 @@
+package webrtc
+
+import (
+	"context"
+	"fmt"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/haowei703/webrtc-server/internal/fileutil"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ThumbnailSink 按固定间隔把最新一帧缩略图写入 <dir>/<session>_<track>.jpg
+type ThumbnailSink struct {
+	path     string
+	interval time.Duration
+	width    int
+	last     time.Time
+}
+
+func NewThumbnailSink(cfg config.ThumbnailConfig, sessionID, trackID string) (*ThumbnailSink, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating thumbnail directory: %w", err)
+	}
+	return &ThumbnailSink{
+		path:     filepath.Join(cfg.Dir, fmt.Sprintf("%s_%s.jpg", sessionID, fileutil.SanitizeName(trackID))),
+		interval: cfg.Interval,
+		width:    cfg.Width,
+	}, nil
+}
+
+func (t *ThumbnailSink) HandleFrame(_ context.Context, frame *Frame) error {
+	if time.Since(t.last) < t.interval {
+		return nil
+	}
+	t.last = time.Now()
+
+	img, err := frame.Image()
+	if err != nil {
+		return err
+	}
+	thumb := resizeNearest(img, t.width)
+
+	// 先写临时文件再重命名，避免读到写了一半的图片
+	tmp := t.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("creating thumbnail: %w", err)
+	}
+	if err := jpeg.Encode(f, thumb, &jpeg.Options{Quality: 80}); err != nil {
+		f.Close()
+		return fmt.Errorf("encoding thumbnail: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.path)
+}
+
+func (t *ThumbnailSink) Close() error {
+	return nil
+}
+
+// resizeNearest 按宽度等比缩放，宽度不大于原图时返回原图
+func resizeNearest(src image.Image, width int) image.Image {
+	b := src.Bounds()
+	if width <= 0 || width >= b.Dx() {
+		return src
+	}
+	height := b.Dy() * width / b.Dx()
+	if height == 0 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		sy := b.Min.Y + y*b.Dy()/height
+		for x := 0; x < width; x++ {
+			dst.Set(x, y, src.At(b.Min.X+x*b.Dx()/width, sy))
+		}
+	}
+	return dst
+}
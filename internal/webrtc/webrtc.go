@@ -3,34 +3,45 @@ package webrtc
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/haowei703/webrtc-server/internal/config"
+	"github.com/pion/interceptor"
 	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
-	"log"
+	"log/slog"
 )
 
 // RtcManager webRTC连接管理类
 type RtcManager struct {
 	PeerConnection *webrtc.PeerConnection
+	logger         *slog.Logger
 }
 
-func NewWebRTCManager() (*RtcManager, error) {
+// NewWebRTCManager 创建 PeerConnection，interceptors 只作用于该 PeerConnection
+func NewWebRTCManager(cfg *config.Config, logger *slog.Logger, interceptors ...interceptor.Factory) (*RtcManager, error) {
 	// 创建 PeerConnection 配置
-	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: []string{"stun:stun.l.google.com:19302"},
-			},
-		},
+	rtcConfig := webrtc.Configuration{}
+	for _, server := range cfg.ICE.Servers {
+		rtcConfig.ICEServers = append(rtcConfig.ICEServers, webrtc.ICEServer{
+			URLs:       server.URLs,
+			Username:   server.Username,
+			Credential: server.Credential,
+		})
+	}
+
+	api, err := newAPI(cfg.Codecs, interceptors...)
+	if err != nil {
+		return nil, err
 	}
 
 	// 创建新的 PeerConnection
-	peerConnection, err := webrtc.NewPeerConnection(config)
+	peerConnection, err := api.NewPeerConnection(rtcConfig)
 	if err != nil {
 		return nil, err
 	}
 
 	manager := &RtcManager{
 		PeerConnection: peerConnection,
+		logger:         logger,
 	}
 
 	// 设置 ICE 候选者处理程序
@@ -38,30 +49,37 @@ func NewWebRTCManager() (*RtcManager, error) {
 		if candidate != nil {
 			jsonCandidate, _ := json.Marshal(candidate.ToJSON())
 			// 这里可以将 ICE 候选者发送到远端
-			log.Printf("New ICE Candidate: %s\n", jsonCandidate)
+			logger.Debug("new ICE candidate", "candidate", string(jsonCandidate))
 		}
 	})
 
 	peerConnection.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
-		fmt.Printf("Connection State has changed %s \n", state.String())
+		logger.Info("ICE connection state has changed", "state", state.String())
 	})
 
 	// Create a video track
 	// 使用vp8编码器
 	videoTrack, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: "video/vp8"}, "video", "pion")
 	if err != nil {
-		fmt.Printf("Error creating video track: %s\n", err)
+		logger.Error("error creating video track", "error", err)
 	}
 
 	_, err = peerConnection.AddTrack(videoTrack)
 	if err != nil {
-		fmt.Printf("Error creating video track: %s\n", err)
+		logger.Error("error adding video track", "error", err)
 	}
 
 	return manager, nil
 }
 
 func (manager *RtcManager) HandleOffer(offer webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	// 与服务端发起的 ICE restart 冲突时放弃本端的 offer，以客户端为准
+	if manager.PeerConnection.SignalingState() == webrtc.SignalingStateHaveLocalOffer {
+		if err := manager.PeerConnection.SetLocalDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeRollback}); err != nil {
+			return nil, fmt.Errorf("rollback local offer: %w", err)
+		}
+	}
+
 	// 设置远端描述
 	err := manager.PeerConnection.SetRemoteDescription(offer)
 	if err != nil {
@@ -82,12 +100,32 @@ func (manager *RtcManager) HandleOffer(offer webrtc.SessionDescription) (*webrtc
 
 	parsedSDP := sdp.SessionDescription{}
 	if err := parsedSDP.Unmarshal([]byte(offer.SDP)); err != nil {
-		log.Fatalf("Failed to unmarshal SDP: %v", err)
+		return nil, fmt.Errorf("failed to unmarshal SDP: %w", err)
 	}
 
 	return &answer, nil
 }
 
+// RestartICE 创建 ICE restart 的 offer，正在协商时返回错误
+func (manager *RtcManager) RestartICE() (*webrtc.SessionDescription, error) {
+	if state := manager.PeerConnection.SignalingState(); state != webrtc.SignalingStateStable {
+		return nil, fmt.Errorf("negotiation in progress: %s", state)
+	}
+	offer, err := manager.PeerConnection.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+	if err != nil {
+		return nil, err
+	}
+	if err := manager.PeerConnection.SetLocalDescription(offer); err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
+
+// HandleAnswer 处理客户端对服务端 offer 的应答
+func (manager *RtcManager) HandleAnswer(answer webrtc.SessionDescription) error {
+	return manager.PeerConnection.SetRemoteDescription(answer)
+}
+
 func (manager *RtcManager) AddICECandidate(candidate webrtc.ICECandidateInit) error {
 	return manager.PeerConnection.AddICECandidate(candidate)
 }